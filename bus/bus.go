@@ -7,6 +7,7 @@ import (
 // Busはメッセージの送受信責務を持つ
 type Bus interface {
 	Broadcast(m *message.Message) error
-	Subscribe() <-chan *message.Message
+	// Subscribe は購読用のチャネルを返します。opts で購読者ごとのバッファやポリシーを指定できます。
+	Subscribe(opts ...SubscribeOption) <-chan *message.Message
 	Close()
 }
@@ -8,31 +8,79 @@ import (
 )
 
 // MemoryBus は bus.Bus インターフェースのインメモリ実装です。
-// 内部で購読者のチャネルリストを保持し、ブロードキャストされたメッセージを
+// 内部で購読者ごとのキューを保持し、ブロードキャストされたメッセージを
 // すべての購読者に配送します。
 type MemoryBus struct {
-	// 購読しているすべてのチャネルのスライス
-	subscribers []chan *message.Message
+	// 購読しているすべての購読者のスライス
+	subscribers []*subscriber
 
 	// subscribers スライスを保護するための読み書きミューテックス
 	mu sync.RWMutex
 
 	// バスが閉じられているかどうかを示すフラグ
 	isClosed bool
+
+	// 購読者ごとの設定の既定値
+	defaults subscribeOptions
+
+	// 決して破棄されない Kind
+	criticalKinds map[message.Kind]bool
+
+	// メッセージに割り当てるセッションID
+	sessionID string
+
+	// 購読者がメッセージを破棄したときに呼び出す関数。nil の場合は呼び出しません。
+	onDrop func(subscriber string, m *message.Message)
+
+	// 通し番号の割り当てと配送を直列化し、すべての購読者に Seq の順で届くようにします。
+	sendMu sync.Mutex
+	seq    uint64
 }
 
 // NewMemoryBus は新しい MemoryBus を生成します。
-func NewMemoryBus() Bus {
-	return &MemoryBus{
-		subscribers: make([]chan *message.Message, 0),
+func NewMemoryBus(opts ...Option) Bus {
+	b := &MemoryBus{
+		subscribers: make([]*subscriber, 0),
+		defaults: subscribeOptions{
+			bufferSize:   defaultBufferSize,
+			policy:       PolicyDropNewest,
+			blockTimeout: defaultBlockTimeout,
+		},
+	}
+	WithCriticalKinds(DefaultCriticalKinds...)(b)
+	for _, opt := range opts {
+		opt(b)
 	}
+	return b
 }
 
 // Broadcast はメッセージをすべての購読者にブロードキャストします。
-// この操作はノンブロッキングです。もし購読者のチャネルバッファが一杯の場合、
-// その購読者へのメッセージはドロップされます。
+// クリティカルな Kind のメッセージは必ず配送されます。それ以外のメッセージは、
+// 購読者のバッファが一杯の場合、その購読者のポリシーに従って破棄されるか、
+// PolicyBlock の場合はタイムアウトまで待ちます。
+// 待つのはバス全体のロックを持たない間なので、遅い購読者がいても、ほかの送信者や Subscribe は待たされません。
 func (b *MemoryBus) Broadcast(m *message.Message) error {
-	// 読み取りロックを使用することで、複数のブロードキャストが並行して実行できます。
+	b.mu.RLock()
+	if b.isClosed {
+		b.mu.RUnlock()
+		return fmt.Errorf("bus is closed")
+	}
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	// PolicyBlock の購読者のキューに空きができるのを、ロックを持たずに待ちます。
+	var ready map[*subscriber]bool
+	for _, s := range subscribers {
+		if s.waitForSpace(m) {
+			if ready == nil {
+				ready = make(map[*subscriber]bool)
+			}
+			ready[s] = true
+		}
+	}
+
+	// 読み取りロックで購読者の一覧を保護します。通し番号の割り当てと配送は sendMu で直列化します。
+	// ここではキューに積むだけで、待つことはありません。
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
@@ -40,41 +88,46 @@ func (b *MemoryBus) Broadcast(m *message.Message) error {
 		return fmt.Errorf("bus is closed")
 	}
 
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+
+	b.stamp(m)
+
 	// すべての購読者にメッセージを送信
-	for _, ch := range b.subscribers {
-		select {
-		case ch <- m:
-			// メッセージを正常に送信
-		default:
-			// 購読者の受信が追いついていない場合。ここではメッセージをドロップする。
-			// 必要であれば、ここでログを出力することもできる。
-		}
+	for _, s := range b.subscribers {
+		s.deliver(m, ready[s])
 	}
 
 	return nil
 }
 
 // Subscribe は新しい購読者を追加し、メッセージを受信するためのチャネルを返します。
-func (b *MemoryBus) Subscribe() <-chan *message.Message {
+// 購読者は、チャネルが閉じられるまで受信し続ける必要があります。
+func (b *MemoryBus) Subscribe(opts ...SubscribeOption) <-chan *message.Message {
 	// 書き込みロックを使用することで、購読者の追加中に他の操作が実行されるのを防ぎます。
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	// 新しい購読者のためのチャネルを作成（バッファを持たせる）
-	newSubscriberCh := make(chan *message.Message, 16)
+	o := b.defaults
+	for _, opt := range opts {
+		opt(&o)
+	}
 
 	if b.isClosed {
 		// バスが既に閉じられている場合は、閉じたチャネルを返す
-		close(newSubscriberCh)
-		return newSubscriberCh
+		ch := make(chan *message.Message)
+		close(ch)
+		return ch
 	}
 
-	b.subscribers = append(b.subscribers, newSubscriberCh)
+	s := newSubscriber(o, b.isCritical, b.onDrop)
+	b.subscribers = append(b.subscribers, s)
 
-	return newSubscriberCh
+	return s.out
 }
 
 // Close はバスを閉じ、すべての購読者チャネルをクローズします。
+// 各購読者のキューに残っているメッセージは、すべて配送されてからチャネルが閉じられます。
 // これにより、range ch ループで待機しているすべてのゴルーチンが終了します。
 func (b *MemoryBus) Close() {
 	b.mu.Lock()
@@ -82,13 +135,45 @@ func (b *MemoryBus) Close() {
 
 	if !b.isClosed {
 		b.isClosed = true
-		for _, ch := range b.subscribers {
-			close(ch)
+		for _, s := range b.subscribers {
+			s.close()
 		}
-		// メモリリークを防ぐためにスライスをクリア
-		b.subscribers = nil
 	}
 }
 
+// Stats は、購読者ごとの配送状況を返します。
+func (b *MemoryBus) Stats() []SubscriberStats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	stats := make([]SubscriberStats, 0, len(b.subscribers))
+	for _, s := range b.subscribers {
+		stats = append(stats, s.stats())
+	}
+	return stats
+}
+
+// stamp は、メッセージに ID、通し番号、セッションIDを割り当てます。
+// ジャーナルの再生などで既に割り当てられている値は、そのまま残します。
+func (b *MemoryBus) stamp(m *message.Message) {
+	if m.Seq == 0 {
+		b.seq++
+		m.Seq = b.seq
+	} else if m.Seq > b.seq {
+		b.seq = m.Seq
+	}
+	if m.ID == "" {
+		m.ID = message.NewID()
+	}
+	if m.SessionID == "" {
+		m.SessionID = b.sessionID
+	}
+}
+
+func (b *MemoryBus) isCritical(kind message.Kind) bool {
+	return b.criticalKinds[kind]
+}
+
 // コンパイル時に Bus インターフェースを実装していることを保証します。
 var _ Bus = (*MemoryBus)(nil)
+var _ StatsReporter = (*MemoryBus)(nil)
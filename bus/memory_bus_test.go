@@ -0,0 +1,154 @@
+package bus
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sat8bit/kaigi/message"
+)
+
+// stall は、受信しない購読者の配送ゴルーチンが最初のメッセージを抱えて止まるまで待ちます。
+// これ以降にブロードキャストしたメッセージは、すべて購読者のキューに積まれます。
+func stall(t *testing.T, b *MemoryBus, s *subscriber) {
+	t.Helper()
+	b.Broadcast(&message.Message{Kind: message.KindLog, Text: "primer"})
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		s.mu.Lock()
+		n := len(s.queue)
+		s.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("subscriber did not take the first message")
+}
+
+func TestMemoryBusPolicies(t *testing.T) {
+	log := func(text string) *message.Message { return &message.Message{Kind: message.KindLog, Text: text} }
+	cha := func(text string) *message.Message { return &message.Message{Kind: message.KindCha, Text: text} }
+
+	tests := []struct {
+		name        string
+		policy      Policy
+		messages    []*message.Message
+		want        []string
+		wantDropped uint64
+	}{
+		{name: "drop newest", policy: PolicyDropNewest, messages: []*message.Message{log("1"), log("2"), log("3"), log("4")}, want: []string{"primer", "1", "2"}, wantDropped: 2},
+		{name: "drop oldest", policy: PolicyDropOldest, messages: []*message.Message{log("1"), log("2"), log("3"), log("4")}, want: []string{"primer", "3", "4"}, wantDropped: 2},
+		{name: "block times out", policy: PolicyBlock, messages: []*message.Message{log("1"), log("2"), log("3"), log("4")}, want: []string{"primer", "1", "2"}, wantDropped: 2},
+		{name: "critical kinds are never dropped", policy: PolicyDropNewest, messages: []*message.Message{cha("1"), cha("2"), cha("3"), cha("4")}, want: []string{"primer", "1", "2", "3", "4"}, wantDropped: 0},
+		{name: "drop oldest skips critical kinds", policy: PolicyDropOldest, messages: []*message.Message{cha("1"), log("2"), log("3")}, want: []string{"primer", "1", "3"}, wantDropped: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var handled uint64
+			b := NewMemoryBus(WithDropHandler(func(subscriber string, m *message.Message) {
+				mu.Lock()
+				defer mu.Unlock()
+				if subscriber != "test" {
+					t.Errorf("got subscriber %q, want test", subscriber)
+				}
+				handled++
+			})).(*MemoryBus)
+			ch := b.Subscribe(WithName("test"), WithBufferSize(2), WithPolicy(tt.policy), WithBlockTimeout(10*time.Millisecond))
+			stall(t, b, b.subscribers[0])
+
+			for _, m := range tt.messages {
+				if err := b.Broadcast(m); err != nil {
+					t.Fatalf("broadcast: %v", err)
+				}
+			}
+			b.Close()
+
+			var got []string
+			for m := range ch {
+				got = append(got, m.Text)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+			if dropped := b.Stats()[0].Dropped; dropped != tt.wantDropped {
+				t.Errorf("got %d dropped, want %d", dropped, tt.wantDropped)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if handled != tt.wantDropped {
+				t.Errorf("drop handler was called %d times, want %d", handled, tt.wantDropped)
+			}
+		})
+	}
+}
+
+// TestMemoryBusBlockingSubscriber は、遅い PolicyBlock の購読者がいても、並行する送信が取りこぼされず Seq の順に届き、
+// その間も Subscribe が待たされないことを確かめます。-race を付けて実行してください。
+func TestMemoryBusBlockingSubscriber(t *testing.T) {
+	const senders, perSender = 4, 50
+	b := NewMemoryBus()
+	slow := b.Subscribe(WithName("slow"), WithBufferSize(1), WithPolicy(PolicyBlock), WithBlockTimeout(time.Minute))
+	fast := b.Subscribe(WithName("fast"), WithBufferSize(senders*perSender))
+
+	var sendWG sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		sendWG.Add(1)
+		go func() {
+			defer sendWG.Done()
+			for j := 0; j < perSender; j++ {
+				if err := b.Broadcast(&message.Message{Kind: message.KindLog, Text: "x"}); err != nil {
+					t.Errorf("broadcast: %v", err)
+					return
+				}
+			}
+		}()
+	}
+
+	subscribed := make(chan (<-chan *message.Message))
+	go func() { subscribed <- b.Subscribe(WithName("late")) }()
+	select {
+	case late := <-subscribed:
+		go func() {
+			for range late {
+			}
+		}()
+	case <-time.After(5 * time.Second):
+		t.Fatal("Subscribe blocked behind a blocking subscriber")
+	}
+
+	receive := func(ch <-chan *message.Message, counts *int, wg *sync.WaitGroup, delay time.Duration) {
+		defer wg.Done()
+		var last uint64
+		for m := range ch {
+			if m.Seq <= last {
+				t.Errorf("got seq %d after %d", m.Seq, last)
+			}
+			last = m.Seq
+			*counts++
+			time.Sleep(delay)
+		}
+	}
+	var slowCount, fastCount int
+	var recvWG sync.WaitGroup
+	recvWG.Add(2)
+	go receive(slow, &slowCount, &recvWG, 100*time.Microsecond)
+	go receive(fast, &fastCount, &recvWG, 0)
+
+	sendWG.Wait()
+	b.Close()
+	recvWG.Wait()
+
+	if slowCount != senders*perSender {
+		t.Errorf("slow subscriber got %d messages, want %d", slowCount, senders*perSender)
+	}
+	if fastCount != senders*perSender {
+		t.Errorf("fast subscriber got %d messages, want %d", fastCount, senders*perSender)
+	}
+}
@@ -0,0 +1,180 @@
+package bus
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sat8bit/kaigi/message"
+)
+
+// Policy は、購読者のバッファが一杯のときに、新しいメッセージをどう扱うかを定義します。
+// クリティカルな Kind のメッセージには適用されず、それらは常に配送されます。
+type Policy string
+
+const (
+	// PolicyDropNewest は、新しく届いたメッセージを破棄します。
+	PolicyDropNewest Policy = "drop-newest"
+	// PolicyDropOldest は、バッファ内の最も古い（クリティカルでない）メッセージを破棄します。
+	PolicyDropOldest Policy = "drop-oldest"
+	// PolicyBlock は、バッファに空きができるまで待ちます。タイムアウトした場合は破棄します。
+	PolicyBlock Policy = "block"
+)
+
+// ParsePolicy は、文字列を Policy に変換します。
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case PolicyDropNewest, PolicyDropOldest, PolicyBlock:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown bus policy '%s'", s)
+}
+
+// DefaultCriticalKinds は、バッファの状態にかかわらず決して破棄されない Kind です。
+// 会話の内容や進行に関わるメッセージが含まれ、KindLog は含まれません。
+var DefaultCriticalKinds = []message.Kind{
+	message.KindSystem,
+	message.KindCha,
+	message.KindError,
+	message.KindEnd,
+	message.KindTurnChanged,
+	message.KindJoin,
+	message.KindLeave,
+	message.KindRelationship,
+	message.KindTurnRequest,
+	message.KindTurnRelease,
+}
+
+const (
+	defaultBufferSize   = 16
+	defaultBlockTimeout = 100 * time.Millisecond
+)
+
+// Option は、MemoryBus 全体の設定を変更します。
+type Option func(*MemoryBus)
+
+// WithDefaultBufferSize は、購読者ごとのバッファサイズの既定値を設定します。
+func WithDefaultBufferSize(n int) Option {
+	return func(b *MemoryBus) {
+		b.defaults.bufferSize = n
+	}
+}
+
+// WithDefaultPolicy は、バッファが一杯のときの振る舞いの既定値を設定します。
+func WithDefaultPolicy(p Policy) Option {
+	return func(b *MemoryBus) {
+		b.defaults.policy = p
+	}
+}
+
+// WithDefaultBlockTimeout は、PolicyBlock で待つ時間の既定値を設定します。
+func WithDefaultBlockTimeout(d time.Duration) Option {
+	return func(b *MemoryBus) {
+		b.defaults.blockTimeout = d
+	}
+}
+
+// WithCriticalKinds は、決して破棄されない Kind を設定します。
+func WithCriticalKinds(kinds ...message.Kind) Option {
+	return func(b *MemoryBus) {
+		b.criticalKinds = make(map[message.Kind]bool, len(kinds))
+		for _, k := range kinds {
+			b.criticalKinds[k] = true
+		}
+	}
+}
+
+// WithDropHandler は、購読者がメッセージを破棄するたびに呼び出される関数を設定します。
+// 購読者の名前と破棄されたメッセージを受け取ります。メトリクスの集計など、すぐに戻る処理に使います。
+func WithDropHandler(handler func(subscriber string, m *message.Message)) Option {
+	return func(b *MemoryBus) {
+		b.onDrop = handler
+	}
+}
+
+// WithSessionID は、ブロードキャストされるメッセージに割り当てるセッションIDを設定します。
+func WithSessionID(id string) Option {
+	return func(b *MemoryBus) {
+		b.sessionID = id
+	}
+}
+
+// subscribeOptions は、購読者ごとの設定です。
+type subscribeOptions struct {
+	name         string
+	bufferSize   int
+	policy       Policy
+	blockTimeout time.Duration
+	// filters は、配送するメッセージを選ぶ条件です。すべてを満たすメッセージだけが配送されます。
+	filters []func(*message.Message) bool
+}
+
+// accepts は、メッセージがすべての条件を満たすかどうかを返します。
+func (o *subscribeOptions) accepts(m *message.Message) bool {
+	for _, f := range o.filters {
+		if !f(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// SubscribeOption は、購読者ごとの設定を変更します。
+type SubscribeOption func(*subscribeOptions)
+
+// WithName は、ログや統計で購読者を識別するための名前を設定します。
+func WithName(name string) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.name = name
+	}
+}
+
+// WithBufferSize は、この購読者のバッファサイズを設定します。
+func WithBufferSize(n int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.bufferSize = n
+	}
+}
+
+// WithPolicy は、この購読者のバッファが一杯のときの振る舞いを設定します。
+func WithPolicy(p Policy) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.policy = p
+	}
+}
+
+// WithBlockTimeout は、この購読者に PolicyBlock で待つ時間を設定します。
+func WithBlockTimeout(d time.Duration) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.blockTimeout = d
+	}
+}
+
+// WithKinds は、指定された Kind のメッセージだけを受け取るようにします。
+func WithKinds(kinds ...message.Kind) SubscribeOption {
+	set := make(map[message.Kind]bool, len(kinds))
+	for _, k := range kinds {
+		set[k] = true
+	}
+	return WithFilter(func(m *message.Message) bool {
+		return set[m.Kind]
+	})
+}
+
+// WithSenders は、指定されたペルソナが送ったメッセージだけを受け取るようにします。
+func WithSenders(personaIds ...string) SubscribeOption {
+	set := make(map[string]bool, len(personaIds))
+	for _, id := range personaIds {
+		set[id] = true
+	}
+	return WithFilter(func(m *message.Message) bool {
+		return m.From != nil && set[m.From.PersonaId]
+	})
+}
+
+// WithFilter は、predicate が true を返すメッセージだけを受け取るようにします。
+// 複数の条件を指定した場合は、すべてを満たすメッセージだけが配送されます。
+func WithFilter(predicate func(*message.Message) bool) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.filters = append(o.filters, predicate)
+	}
+}
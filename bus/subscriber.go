@@ -0,0 +1,217 @@
+package bus
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sat8bit/kaigi/message"
+)
+
+// SubscriberStats は、ひとつの購読者の配送状況です。
+type SubscriberStats struct {
+	Name          string
+	Policy        Policy
+	BufferSize    int
+	Delivered     uint64
+	Dropped       uint64
+	DroppedByKind map[message.Kind]uint64
+}
+
+// StatsReporter は、購読者ごとの配送状況を報告できるバスが満たすインターフェースです。
+type StatsReporter interface {
+	Stats() []SubscriberStats
+}
+
+// subscriber は、ひとつの購読者へのキューと配送用のゴルーチンを管理します。
+// Broadcast はキューに積むだけなので、購読者の処理が遅くても送信側はブロックしません。
+// PolicyBlock の購読者のキューが一杯の場合だけ、送信側はバス全体のロックの外で空きを待ちます。
+type subscriber struct {
+	opts       subscribeOptions
+	isCritical func(message.Kind) bool
+	onDrop     func(subscriber string, m *message.Message)
+	out        chan *message.Message
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []*message.Message
+	closed bool
+	// space は、キューから取り出されたことを PolicyBlock で待っている送信側に知らせます。
+	space chan struct{}
+
+	delivered     uint64
+	dropped       uint64
+	droppedByKind map[message.Kind]uint64
+}
+
+func newSubscriber(opts subscribeOptions, isCritical func(message.Kind) bool, onDrop func(string, *message.Message)) *subscriber {
+	s := &subscriber{
+		opts:          opts,
+		isCritical:    isCritical,
+		onDrop:        onDrop,
+		out:           make(chan *message.Message),
+		space:         make(chan struct{}, 1),
+		droppedByKind: make(map[message.Kind]uint64),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	go s.pump()
+	return s
+}
+
+// deliver は、購読の条件に合うメッセージをキューに積みます。待つことはありません。
+// クリティカルな Kind のメッセージは、バッファの状態にかかわらず必ず積みます。
+// ready は、waitForSpace で空きができるのを待てたかどうかです。
+// メッセージを破棄した場合は、ロックを放してから onDrop に知らせます。
+func (s *subscriber) deliver(m *message.Message, ready bool) {
+	if !s.opts.accepts(m) {
+		return
+	}
+
+	s.mu.Lock()
+	dropped := s.enqueueOrDropLocked(m, ready)
+	s.mu.Unlock()
+
+	if dropped != nil && s.onDrop != nil {
+		s.onDrop(s.opts.name, dropped)
+	}
+}
+
+// enqueueOrDropLocked は、ポリシーに従って m をキューに積み、破棄したメッセージがあれば返します。
+func (s *subscriber) enqueueOrDropLocked(m *message.Message, ready bool) *message.Message {
+	if s.isCritical(m.Kind) || len(s.queue) < s.opts.bufferSize {
+		s.enqueueLocked(m)
+		return nil
+	}
+
+	switch s.opts.policy {
+	case PolicyDropOldest:
+		if i := s.oldestDroppableLocked(); i >= 0 {
+			dropped := s.queue[i]
+			s.countDropLocked(dropped)
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			s.enqueueLocked(m)
+			return dropped
+		}
+	case PolicyBlock:
+		// 空きを待てた後にほかの送信者が先に積んだ場合は、待ったメッセージを捨てずに、バッファを超えて積みます。
+		if ready {
+			s.enqueueLocked(m)
+			return nil
+		}
+	}
+
+	s.countDropLocked(m)
+	return m
+}
+
+// waitForSpace は、PolicyBlock の購読者について、m を積むためのキューの空きをタイムアウトまで待ちます。
+// 空きがある、または空きができた場合に true を返します。PolicyBlock でない場合や、m を受け取らない場合は待たずに false を返します。
+// バス全体のロックを持たずに呼び出します。
+func (s *subscriber) waitForSpace(m *message.Message) bool {
+	if s.opts.policy != PolicyBlock || !s.opts.accepts(m) || s.isCritical(m.Kind) {
+		return false
+	}
+	if s.hasSpace() {
+		return true
+	}
+
+	timer := time.NewTimer(s.opts.blockTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-s.space:
+			if s.hasSpace() {
+				// 同じ購読者を待っているほかの送信者にも、空きができたことを知らせます。
+				select {
+				case s.space <- struct{}{}:
+				default:
+				}
+				return true
+			}
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
+func (s *subscriber) hasSpace() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue) < s.opts.bufferSize
+}
+
+func (s *subscriber) enqueueLocked(m *message.Message) {
+	s.queue = append(s.queue, m)
+	s.cond.Signal()
+}
+
+// oldestDroppableLocked は、キュー内で最も古い、クリティカルでないメッセージの位置を返します。
+// 見つからない場合は -1 を返します。
+func (s *subscriber) oldestDroppableLocked() int {
+	for i, m := range s.queue {
+		if !s.isCritical(m.Kind) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *subscriber) countDropLocked(m *message.Message) {
+	s.dropped++
+	s.droppedByKind[m.Kind]++
+}
+
+// pump は、キューからメッセージを取り出し、購読者のチャネルに順番に送ります。
+// close された後も、キューに残っているメッセージをすべて送ってからチャネルを閉じます。
+func (s *subscriber) pump() {
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			close(s.out)
+			return
+		}
+		m := s.queue[0]
+		s.queue[0] = nil
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		select {
+		case s.space <- struct{}{}:
+		default:
+		}
+
+		s.out <- m
+
+		s.mu.Lock()
+		s.delivered++
+		s.mu.Unlock()
+	}
+}
+
+func (s *subscriber) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.cond.Broadcast()
+}
+
+func (s *subscriber) stats() SubscriberStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	droppedByKind := make(map[message.Kind]uint64, len(s.droppedByKind))
+	for k, v := range s.droppedByKind {
+		droppedByKind[k] = v
+	}
+	return SubscriberStats{
+		Name:          s.opts.name,
+		Policy:        s.opts.policy,
+		BufferSize:    s.opts.bufferSize,
+		Delivered:     s.delivered,
+		Dropped:       s.dropped,
+		DroppedByKind: droppedByKind,
+	}
+}
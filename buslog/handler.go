@@ -1,10 +1,12 @@
 package buslog
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sat8bit/kaigi/bus"
@@ -12,50 +14,142 @@ import (
 )
 
 // BusHandler is a slog.Handler that writes log records to a bus.Bus.
-// It also wraps another slog.Handler to continue writing to the original destination.
+// It can also tee records to another slog.Handler (e.g. a JSON or text handler
+// writing to a file or stderr) so that logs survive outside the bus.
 type BusHandler struct {
-	bus bus.Bus
+	bus   bus.Bus
+	level slog.Leveler
+	next  slog.Handler
+
+	// attrs holds the attributes added with WithAttrs, already formatted as " key=value" pairs.
+	attrs string
+	// prefix is the current group path, e.g. "request.", prepended to attribute keys.
+	prefix string
+}
+
+// Option configures a BusHandler.
+type Option func(*BusHandler)
+
+// WithLevel sets the minimum level of records broadcast to the bus. The default is slog.LevelInfo.
+func WithLevel(level slog.Leveler) Option {
+	return func(h *BusHandler) {
+		h.level = level
+	}
+}
+
+// WithTee makes the handler also pass every record to next.
+// next decides on its own which levels it handles.
+func WithTee(next slog.Handler) Option {
+	return func(h *BusHandler) {
+		h.next = next
+	}
 }
 
 // NewBusHandler creates a new BusHandler.
-func NewBusHandler(bus bus.Bus) *BusHandler {
-	return &BusHandler{
-		bus: bus,
+func NewBusHandler(bus bus.Bus, opts ...Option) *BusHandler {
+	h := &BusHandler{
+		bus:   bus,
+		level: slog.LevelInfo,
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	return h
 }
 
 // Enabled reports whether the handler handles records at the given level.
-// The handler ignores records whose level is lower.
+// A record is handled if either the bus or the tee accepts its level.
 func (h *BusHandler) Enabled(ctx context.Context, level slog.Level) bool {
-	return true
+	if level >= h.level.Level() {
+		return true
+	}
+	return h.next != nil && h.next.Enabled(ctx, level)
 }
 
 // Handle handles the Record.
-// It broadcasts the log message to the bus and then passes the record
-// to the wrapped handler.
+// It passes the record to the tee, if any, and then broadcasts it to the bus
+// as a KindLog message including its attributes.
 func (h *BusHandler) Handle(ctx context.Context, r slog.Record) error {
-	// Format the record into a simple string.
-	var buf bytes.Buffer
-	buf.WriteString(fmt.Sprintf("[%s] %s", r.Level, r.Message))
+	var errs []error
+	if h.next != nil && h.next.Enabled(ctx, r.Level) {
+		errs = append(errs, h.next.Handle(ctx, r))
+	}
 
-	return h.bus.Broadcast(&message.Message{
-		Text: buf.String(),
-		At:   time.Now(),
-		Kind: message.KindLog,
-	})
+	if r.Level >= h.level.Level() {
+		var buf strings.Builder
+		fmt.Fprintf(&buf, "[%s] %s", r.Level, r.Message)
+		buf.WriteString(h.attrs)
+		r.Attrs(func(a slog.Attr) bool {
+			writeAttr(&buf, h.prefix, a)
+			return true
+		})
+
+		at := r.Time
+		if at.IsZero() {
+			at = time.Now()
+		}
+		errs = append(errs, h.bus.Broadcast(&message.Message{
+			Text: buf.String(),
+			At:   at,
+			Kind: message.KindLog,
+		}))
+	}
+	return errors.Join(errs...)
 }
 
 // WithAttrs returns a new BusHandler whose attributes consist of
 // the handler's attributes followed by attrs.
 func (h *BusHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return &BusHandler{
-		bus: h.bus,
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	var buf strings.Builder
+	buf.WriteString(h.attrs)
+	for _, a := range attrs {
+		writeAttr(&buf, h.prefix, a)
 	}
+	h2.attrs = buf.String()
+	if h.next != nil {
+		h2.next = h.next.WithAttrs(attrs)
+	}
+	return &h2
 }
 
 // WithGroup returns a new BusHandler with the given group name.
+// Keys of attributes added afterwards are qualified by the group, as in "group.key".
 func (h *BusHandler) WithGroup(name string) slog.Handler {
-	return &BusHandler{
-		bus: h.bus,
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	if h.next != nil {
+		h2.next = h.next.WithGroup(name)
+	}
+	return &h2
+}
+
+// writeAttr writes a as " key=value", flattening groups into dotted keys.
+func writeAttr(buf *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if a.Key != "" {
+			groupPrefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			writeAttr(buf, groupPrefix, ga)
+		}
+		return
+	}
+
+	value := a.Value.String()
+	if strings.ContainsAny(value, " =\"\n") || value == "" {
+		value = strconv.Quote(value)
 	}
+	fmt.Fprintf(buf, " %s%s=%s", prefix, a.Key, value)
 }
@@ -11,11 +11,18 @@ import (
 	"github.com/sat8bit/kaigi/bus"
 	"github.com/sat8bit/kaigi/llm"
 	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/moderation"
 	"github.com/sat8bit/kaigi/persona"
 	"github.com/sat8bit/kaigi/topic"
 	"github.com/sat8bit/kaigi/turn"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/sat8bit/kaigi/cha")
+
 func NewCha(
 	ctx context.Context,
 	chaId string,
@@ -25,6 +32,7 @@ func NewCha(
 	turnManager turn.Manager,
 	turnProvider turn.TurnProvider,
 	topics []*topic.Topic,
+	filter *moderation.Filter,
 ) *Cha {
 	initialLastTalk := time.Now().Add(
 		-time.Duration(persona.MinGapSeconds) * time.Second,
@@ -43,6 +51,7 @@ func NewCha(
 		turnManager:  turnManager,
 		turnProvider: turnProvider,
 		topics:       topics,
+		filter:       filter,
 	}
 }
 
@@ -55,11 +64,15 @@ type Cha struct {
 	turnProvider turn.TurnProvider
 	bus          bus.Bus
 	topics       []*topic.Topic
+	// filter は、生成した発言をブロードキャストする前に検査します。nil の場合は検査しません。
+	filter *moderation.Filter
 
 	mu       sync.Mutex
 	inbox    []*message.Message
 	lastTalk time.Time
 	stopped  bool
+	// lastEvaluatedSeq は、関係性の評価を終えた最後のメッセージの Seq です。
+	lastEvaluatedSeq uint64
 }
 
 func (c *Cha) End() {
@@ -69,7 +82,11 @@ func (c *Cha) End() {
 }
 
 func (c *Cha) Start() {
-	messageCh := c.bus.Subscribe()
+	// 会話に関係するメッセージだけを受け取り、ログなどで inbox が埋まらないようにします。
+	messageCh := c.bus.Subscribe(
+		bus.WithName(c.ChaId),
+		bus.WithKinds(message.KindSystem, message.KindCha, message.KindJoin, message.KindLeave),
+	)
 
 	go func() {
 		ticker := time.NewTicker(1 * time.Second)
@@ -78,6 +95,11 @@ func (c *Cha) Start() {
 		for {
 			select {
 			case <-c.Context.Done():
+				// バスが閉じられるまで、残りのメッセージを読み捨てます。
+				go func() {
+					for range messageCh {
+					}
+				}()
 				return
 
 			case in, ok := <-messageCh:
@@ -98,7 +120,7 @@ func (c *Cha) Start() {
 	}()
 }
 
-func (c *Cha) updateRelationship(msg *message.Message, inboxContext []*message.Message) {
+func (c *Cha) updateRelationship(ctx context.Context, msg *message.Message, inboxContext []*message.Message) {
 	if msg.From == nil || msg.From.PersonaId == "" || msg.From.PersonaId == c.Persona.PersonaId || msg.Kind != message.KindCha {
 		return
 	}
@@ -114,7 +136,7 @@ func (c *Cha) updateRelationship(msg *message.Message, inboxContext []*message.M
 	}
 	c.mu.Unlock()
 
-	updatedRel, err := c.llm.UpdateRelationship(c.Context, &llm.UpdateRelationshipInput{
+	updatedRel, err := c.llm.UpdateRelationship(ctx, &llm.UpdateRelationshipInput{
 		Persona:             c.Persona,
 		TargetPersona:       msg.From,
 		RecentMessages:      inboxContext,
@@ -129,9 +151,19 @@ func (c *Cha) updateRelationship(msg *message.Message, inboxContext []*message.M
 	c.Persona.Relationships[msg.From.PersonaId] = updatedRel
 	c.mu.Unlock()
 
-	slog.InfoContext(c.Context,
-		fmt.Sprintf("%s => %s (affinity:%d) %s", c.Persona.DisplayName, msg.From.DisplayName, updatedRel.Affinity, updatedRel.Impression),
-	)
+	summary := fmt.Sprintf("%s => %s (affinity:%d) %s", c.Persona.DisplayName, msg.From.DisplayName, updatedRel.Affinity, updatedRel.Impression)
+	slog.InfoContext(c.Context, summary)
+
+	if err := c.bus.Broadcast(&message.Message{
+		ReplyTo:      msg.ID,
+		From:         c.Persona,
+		Text:         summary,
+		At:           time.Now(),
+		Kind:         message.KindRelationship,
+		Relationship: updatedRel,
+	}); err != nil {
+		slog.ErrorContext(c.Context, fmt.Sprintf("Cha %s: Broadcast error on relationship update: %v", c.ChaId, err))
+	}
 }
 
 func (c *Cha) tryToTalk() {
@@ -147,29 +179,55 @@ func (c *Cha) tryToTalk() {
 		c.mu.Unlock()
 		return
 	}
-	lastTalkTime := c.lastTalk
+	lastEvaluatedSeq := c.lastEvaluatedSeq
 	inboxForContext := make([]*message.Message, len(c.inbox))
 	copy(inboxForContext, c.inbox)
 	c.mu.Unlock()
 
-	for _, msg := range inboxForContext {
-		if msg.At.After(lastTalkTime) {
-			c.updateRelationship(msg, inboxForContext)
+	// 発言の間隔を満たした試行だけをスパンとして記録します。
+	ctx, span := tracer.Start(c.Context, "cha.tryToTalk", trace.WithAttributes(
+		attribute.String("kaigi.persona.id", c.Persona.PersonaId),
+	))
+	defer span.End()
+
+	for i, msg := range inboxForContext {
+		if msg.Seq <= lastEvaluatedSeq {
+			continue
 		}
+		// 評価対象の発言までの会話だけを渡し、その発言が会話の末尾になるようにします。
+		c.updateRelationship(ctx, msg, inboxForContext[:i+1])
+		lastEvaluatedSeq = msg.Seq
 	}
 
-	if err := c.turnManager.Acquire(c.Context); err != nil {
+	c.mu.Lock()
+	c.lastEvaluatedSeq = lastEvaluatedSeq
+	c.mu.Unlock()
+
+	_, acquireSpan := tracer.Start(ctx, "turn.acquire")
+	err := c.turnManager.Acquire(ctx)
+	acquireSpan.End()
+	if err != nil {
+		span.SetAttributes(attribute.Bool("kaigi.spoke", false))
 		return
 	}
 	defer c.turnManager.Release()
 
+	// 発言の生成を始めたことを知らせます（ライブビューアの入力中表示などに使います）。
+	if err := c.bus.Broadcast(&message.Message{
+		From: c.Persona,
+		At:   time.Now(),
+		Kind: message.KindTyping,
+	}); err != nil {
+		slog.ErrorContext(c.Context, fmt.Sprintf("Cha %s: Broadcast error on typing: %v", c.ChaId, err))
+	}
+
 	c.mu.Lock()
 	inboxForGeneration := make([]*message.Message, len(c.inbox))
 	copy(inboxForGeneration, c.inbox)
 	c.mu.Unlock()
 
 	// ★★★ 関係性情報を GenerateInput に追加 ★★★
-	resp, err := c.llm.Generate(c.Context, llm.GenerateInput{
+	input := llm.GenerateInput{
 		ChaId:          c.ChaId,
 		Persona:        c.Persona,
 		RecentMessages: inboxForGeneration,
@@ -177,9 +235,19 @@ func (c *Cha) tryToTalk() {
 		MaxTurns:       c.turnProvider.GetMaxTurns(),
 		Topics:         c.topics,
 		Relationships:  c.Persona.Relationships,
-	})
+	}
+	resp, err := c.llm.Generate(ctx, input)
+
+	publish := true
+	if err == nil && c.filter != nil {
+		resp, publish, err = c.filter.Apply(ctx, c.Persona, resp, func() (string, error) {
+			return c.llm.Generate(ctx, input)
+		})
+	}
 
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		slog.ErrorContext(c.Context, fmt.Sprintf("Cha %s: LLM error: %v", c.ChaId, err))
 		if berr := c.bus.Broadcast(&message.Message{
 			From: c.Persona,
@@ -197,12 +265,30 @@ func (c *Cha) tryToTalk() {
 	c.lastTalk = now
 	c.mu.Unlock()
 
+	span.SetAttributes(attribute.Bool("kaigi.spoke", publish))
+	if !publish {
+		// モデレーションで破棄された発言は流さず、次の機会を待ちます。
+		return
+	}
+
 	if err := c.bus.Broadcast(&message.Message{
-		From: c.Persona,
-		Text: resp,
-		At:   now,
-		Kind: message.KindCha,
+		ReplyTo: lastUtteranceID(inboxForGeneration, c.Persona.PersonaId),
+		From:    c.Persona,
+		Text:    resp,
+		At:      now,
+		Kind:    message.KindCha,
 	}); err != nil {
 		slog.ErrorContext(c.Context, fmt.Sprintf("Cha %s: Broadcast error: %v", c.ChaId, err))
 	}
 }
+
+// lastUtteranceID は、personaId 以外の参加者による最後の発言の ID を返します。
+func lastUtteranceID(messages []*message.Message, personaId string) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if msg.Kind == message.KindCha && msg.From != nil && msg.From.PersonaId != personaId {
+			return msg.ID
+		}
+	}
+	return ""
+}
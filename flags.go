@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/renderer"
+)
+
+// rendererFlags は、セッションの実行と kaigi render で共通の、レンダラーの設定のフラグです。
+// レンダラーの設定を増やすときは、ここに加えれば両方で使えます。
+type rendererFlags struct {
+	outputDir     *string
+	mdTemplate    *string
+	onError       *string
+	consoleMode   *string
+	typingDelay   *time.Duration
+	consoleLog    *bool
+	dramaticSwing *int
+	relGraph      *bool
+	graphAsset    *string
+	graphOutput   *string
+	frontMatter   *string
+	fmFields      *string
+	categories    *string
+	draft         *bool
+	htmlOutput    *string
+	htmlTemplate  *string
+	jsonOutput    *string
+	subOutput     *string
+	subTiming     *string
+	subCPS        *float64
+	subLineWidth  *int
+	subMaxLines   *int
+	voiceOutput   *string
+}
+
+// registerRendererFlags は、レンダラーの設定のフラグを fs に登録します。
+func registerRendererFlags(fs *flag.FlagSet) *rendererFlags {
+	return &rendererFlags{
+		outputDir:     fs.String("output", "./pages/content/posts", "Directory to save markdown files"),
+		mdTemplate:    fs.String("markdown-template", "", "Path to a text/template file overriding the built-in markdown post layout"),
+		onError:       fs.String("on-error", "draft", "What to do with the markdown post, HTML transcript, subtitles and voice scripts when the session ends with an error (discard, draft, note)"),
+		consoleMode:   fs.String("console", "plain", "Console renderer display: plain (line by line) or tui (redrawn screen with colors, affinities, turn counter and a log pane toggled with 'l')"),
+		typingDelay:   fs.Duration("typing-delay", 50*time.Millisecond, "Delay per character when the console renderer types out utterances, 0 to print them at once"),
+		consoleLog:    fs.Bool("console-log", false, "Show log messages in the console renderer (in tui mode, the initial state of the log pane)"),
+		dramaticSwing: fs.Int("dramatic-swing", persona.DefaultDramaticSwing, "Affinity change within a session flagged as a dramatic swing in outputs and the journal (a flip between liking and disliking is always flagged)"),
+		relGraph:      fs.Bool("relationship-graph", true, "Embed a Mermaid diagram of the affinities between participants in markdown posts"),
+		graphAsset:    fs.String("graph-asset", "", "Also write the relationship graph as a separate file (dot, svg; svg needs Graphviz), empty to disable"),
+		graphOutput:   fs.String("graph-output", "./pages/static/graphs", "Directory to save relationship graph files written by -graph-asset"),
+		frontMatter:   fs.String("front-matter", "toml", "Format of the Hugo front matter in markdown posts (toml, yaml)"),
+		fmFields:      fs.String("front-matter-fields", "", "Comma-separated extra front matter fields (slug, description, source, personas, session)"),
+		categories:    fs.String("categories", "", "Comma-separated Hugo categories to add to markdown posts"),
+		draft:         fs.Bool("draft", false, "Mark markdown posts as Hugo drafts"),
+		htmlOutput:    fs.String("html-output", "./output/html", "Directory to save HTML transcripts"),
+		htmlTemplate:  fs.String("html-template", "", "Path to an html/template file overriding the built-in HTML transcript layout"),
+		jsonOutput:    fs.String("json-output", "./output/json", "Directory to save JSON transcripts"),
+		subOutput:     fs.String("subtitle-output", "./output/subtitles", "Directory to save SRT and WebVTT subtitles"),
+		subTiming:     fs.String("subtitle-timing", "at", "How subtitle timing is derived: from message timestamps (at) or from reading speed (cps)"),
+		subCPS:        fs.Float64("subtitle-cps", 4, "Characters per second a viewer reads, used for -subtitle-timing cps and the last cue"),
+		subLineWidth:  fs.Int("subtitle-line-width", 16, "Maximum characters per subtitle line, including the speaker label"),
+		subMaxLines:   fs.Int("subtitle-max-lines", 2, "Maximum lines per subtitle cue; longer utterances are split into several cues"),
+		voiceOutput:   fs.String("voice-output", "./output/voice", "Directory to save SSML and JSON Lines speech synthesis scripts"),
+	}
+}
+
+// options は、フラグの値を確かめて renderer.Options を組み立てます。
+// maxTurns と keys は、コンソールの設定に使います (buildConsoleConfig を参照)。
+// LLM を使う設定と web レンダラーの設定は含まないため、呼び出し側で設定します。
+func (f *rendererFlags) options(maxTurns int, keys bool) (*renderer.Options, error) {
+	fmConfig, err := buildFrontMatterConfig(*f.frontMatter, *f.fmFields, *f.categories, *f.draft)
+	if err != nil {
+		return nil, fmt.Errorf("invalid front matter settings: %w", err)
+	}
+	errorPolicy, err := renderer.ParseErrorPolicy(*f.onError)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -on-error: %w", err)
+	}
+	subConfig, err := buildSubtitleConfig(*f.subTiming, *f.subCPS, *f.subLineWidth, *f.subMaxLines)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subtitle settings: %w", err)
+	}
+	graphConfig := renderer.GraphConfig{Embed: *f.relGraph, Asset: *f.graphAsset, AssetDir: *f.graphOutput}
+	if err := graphConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid -graph-asset: %w", err)
+	}
+	consoleConfig, err := buildConsoleConfig(*f.consoleMode, *f.typingDelay, *f.consoleLog, maxTurns, keys)
+	if err != nil {
+		return nil, fmt.Errorf("invalid console settings: %w", err)
+	}
+	return &renderer.Options{
+		OutputDir:        *f.outputDir,
+		MarkdownTemplate: *f.mdTemplate,
+		FrontMatter:      fmConfig,
+		OnError:          errorPolicy,
+		Graph:            graphConfig,
+		Console:          consoleConfig,
+		DramaticSwing:    *f.dramaticSwing,
+		HTMLOutput:       *f.htmlOutput,
+		HTMLTemplate:     *f.htmlTemplate,
+		JSONOutput:       *f.jsonOutput,
+		SubtitleOutput:   *f.subOutput,
+		Subtitle:         subConfig,
+		VoiceOutput:      *f.voiceOutput,
+	}, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	buspkg "github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/netbus"
+	"github.com/sat8bit/kaigi/session"
+)
+
+// runHub は、別々のプロセスで動く参加者やレンダラーが接続するバスのハブを起動します。
+// シグナルを受け取るまで動き続けます。
+//
+//	kaigi hub [-listen :7070]
+func runHub(args []string) {
+	fs := flag.NewFlagSet("hub", flag.ExitOnError)
+	var (
+		listen = fs.String("listen", ":7070", "Address to listen on for bus clients")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s hub [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	bus := buspkg.NewMemoryBus(buspkg.WithSessionID(session.NewID(time.Now())))
+	hub := netbus.NewHub(bus)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		<-sigCh
+		bus.Close()
+		hub.Close()
+	}()
+
+	if err := hub.ListenAndServe(*listen); err != nil {
+		slog.Error("bus hub stopped", "error", err)
+		os.Exit(1)
+	}
+	<-closed
+}
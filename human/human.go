@@ -0,0 +1,116 @@
+package human
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/turn"
+)
+
+// NewHuman は新しい Human を生成します。
+// input から1行読み込むごとに、それを persona の発言として会話に流します。
+func NewHuman(
+	ctx context.Context,
+	persona *persona.Persona,
+	input io.Reader,
+	bus bus.Bus,
+	turnManager turn.Manager,
+) *Human {
+	return &Human{
+		Context:     ctx,
+		Persona:     persona,
+		input:       input,
+		bus:         bus,
+		turnManager: turnManager,
+	}
+}
+
+// Human は、端末やソケットから入力された文章を発言として扱う、人間の参加者です。
+// LLM を使う Cha と同じ turn.Manager でターンを取得し、KindCha として発言するため、
+// 他の Cha からは通常の参加者と同じように関係性の評価対象になります。
+type Human struct {
+	Context     context.Context
+	Persona     *persona.Persona
+	input       io.Reader
+	bus         bus.Bus
+	turnManager turn.Manager
+
+	mu      sync.Mutex
+	stopped bool
+	// lastHeardID は、他の参加者による最後の発言の ID です。発言の応答先になります。
+	lastHeardID string
+}
+
+// End は、以降の入力を発言として扱わないようにします。
+func (h *Human) End() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopped = true
+}
+
+// Start は、入力の読み込みを開始します。
+func (h *Human) Start() {
+	messageCh := h.bus.Subscribe(bus.WithName("human-"+h.Persona.PersonaId), bus.WithKinds(message.KindCha))
+	go func() {
+		for msg := range messageCh {
+			if msg.From != nil && msg.From.PersonaId != h.Persona.PersonaId {
+				h.mu.Lock()
+				h.lastHeardID = msg.ID
+				h.mu.Unlock()
+			}
+		}
+	}()
+
+	go func() {
+		scanner := bufio.NewScanner(h.input)
+		for scanner.Scan() {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			if h.isStopped() || h.Context.Err() != nil {
+				return
+			}
+			h.talk(text)
+		}
+		if err := scanner.Err(); err != nil {
+			slog.ErrorContext(h.Context, "failed to read human input", "personaId", h.Persona.PersonaId, "error", err)
+		}
+	}()
+}
+
+func (h *Human) isStopped() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.stopped
+}
+
+func (h *Human) talk(text string) {
+	// 他の Cha が話している最中であれば、話し終わるまで待ちます。
+	if err := h.turnManager.Acquire(h.Context); err != nil {
+		return
+	}
+	defer h.turnManager.Release()
+
+	h.mu.Lock()
+	replyTo := h.lastHeardID
+	h.mu.Unlock()
+
+	if err := h.bus.Broadcast(&message.Message{
+		ReplyTo: replyTo,
+		From:    h.Persona,
+		Text:    text,
+		At:      time.Now(),
+		Kind:    message.KindCha,
+	}); err != nil {
+		slog.ErrorContext(h.Context, "failed to broadcast human message", "personaId", h.Persona.PersonaId, "error", err)
+	}
+}
@@ -0,0 +1,55 @@
+package human
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+)
+
+// ListenUnix は、指定されたパスに Unix ドメインソケットを作成し、
+// 接続してきたクライアントからの入力をひとつの io.Reader として返します。
+// クライアントは何度でも接続し直すことができます（例: `nc -U <path>`）。
+// ctx がキャンセルされると、ソケットは閉じられます。
+func ListenUnix(ctx context.Context, path string) (io.Reader, error) {
+	// 前回の実行で残ったソケットファイルがあれば削除します。
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	go func() {
+		defer pw.Close()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					slog.Error("failed to accept human input connection", "path", path, "error", err)
+				}
+				return
+			}
+			slog.Info("Human input connected", "path", path)
+			// 一度にひとつの接続だけを受け付けます。
+			if _, err := io.Copy(pw, conn); err != nil {
+				slog.Warn("human input connection closed with error", "error", err)
+			}
+			conn.Close()
+		}
+	}()
+
+	return pr, nil
+}
@@ -0,0 +1,245 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/session"
+	"github.com/sat8bit/kaigi/topic"
+)
+
+// Journal は、ジャーナルファイルから読み込んだひとつのセッションです。
+type Journal struct {
+	// Session は、セッションのメタデータです。終了時刻、終了の理由、参加者と集計も、記録から設定済みです。
+	Session *session.Session
+	// Personas は、セッションに現れたペルソナです。Relationships にはセッション終了時の関係性が、
+	// InitialRelationships にはセッション開始時点の関係性が入ります。
+	Personas []*persona.Persona
+	Messages []*message.Message
+	// EndedAt は、セッションの終了時刻です。ジャーナルが途中で途切れている場合はゼロ値です。
+	EndedAt time.Time
+}
+
+// ReadFile は、ジャーナルファイルを読み込みます。
+// 未知の種類のレコードは、新しいバージョンで追加されたものとして読み飛ばします。
+// 種類に必要な内容が欠けたレコードがあれば、その行番号とともにエラーを返します。
+func ReadFile(path string) (*Journal, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal %s: %w", path, err)
+	}
+	defer f.Close()
+
+	j := &Journal{}
+	personas := make(map[string]*persona.Persona)
+	var editorial *session.Editorial
+
+	scanner := bufio.NewScanner(f)
+	// ログには長い行が含まれることがあるため、バッファを大きめにします。
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("failed to parse journal %s line %d: %w", path, line, err)
+		}
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("journal %s line %d: %w", path, line, err)
+		}
+
+		switch r.Type {
+		case RecordSession:
+			if r.Session.SchemaVersion > SchemaVersion {
+				return nil, fmt.Errorf("journal %s has schema version %d, but only up to %d is supported", path, r.Session.SchemaVersion, SchemaVersion)
+			}
+			j.Session = r.Session.toSession()
+		case RecordPersona:
+			p := r.Persona.ToPersona()
+			if _, ok := personas[p.PersonaId]; !ok {
+				personas[p.PersonaId] = p
+				j.Personas = append(j.Personas, p)
+			}
+		case RecordMessage:
+			var from *persona.Persona
+			if r.Message.From != "" {
+				p, ok := personas[r.Message.From]
+				if !ok {
+					return nil, fmt.Errorf("journal %s line %d refers to unknown persona '%s'", path, line, r.Message.From)
+				}
+				from = p
+			}
+			m := r.Message.ToMessage(from)
+			j.Messages = append(j.Messages, m)
+		case RecordEnd:
+			j.EndedAt = r.End.EndedAt
+			editorial = r.End.Editorial.toEditorial()
+			for _, rel := range r.End.Relationships {
+				p, ok := personas[rel.PersonaId]
+				if !ok {
+					continue
+				}
+				p.Relationships[rel.TargetPersonaId] = rel.toRelationship()
+			}
+			for _, rel := range r.End.InitialRelationships {
+				p, ok := personas[rel.PersonaId]
+				if !ok {
+					continue
+				}
+				p.InitialRelationships[rel.TargetPersonaId] = rel.toRelationship()
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal %s: %w", path, err)
+	}
+
+	if j.Session == nil {
+		return nil, fmt.Errorf("journal %s has no session record", path)
+	}
+
+	var reason session.EndReason
+	var stats session.Stats
+	for _, m := range j.Messages {
+		switch m.Kind {
+		case message.KindCha:
+			stats.Count(m.From.PersonaId, m.Text)
+		case message.KindEnd:
+			reason = session.EndReason(m.Text)
+		}
+	}
+	j.Session.End(j.EndedAt, reason, j.Personas, stats)
+	j.Session.Editorial = editorial
+	return j, nil
+}
+
+// Replay は、記録されたメッセージを元の順番でバスに流します。
+func (j *Journal) Replay(b bus.Bus) error {
+	for _, m := range j.Messages {
+		if err := b.Broadcast(m); err != nil {
+			return fmt.Errorf("failed to replay message: %w", err)
+		}
+	}
+	return nil
+}
+
+// validate は、レコードに Type に対応する内容がそろっているかを確かめます。
+// 壊れたジャーナルや途中で途切れたジャーナルを、復元の途中でパニックにせずエラーにするために使います。
+func (r *Record) validate() error {
+	switch r.Type {
+	case RecordSession:
+		if r.Session == nil {
+			return fmt.Errorf("session record has no session")
+		}
+		for _, t := range r.Session.Topics {
+			if t == nil {
+				return fmt.Errorf("session record has an empty topic")
+			}
+		}
+	case RecordPersona:
+		if r.Persona == nil || r.Persona.PersonaId == "" {
+			return fmt.Errorf("persona record has no persona id")
+		}
+	case RecordMessage:
+		if r.Message == nil {
+			return fmt.Errorf("message record has no message")
+		}
+		return r.Message.Validate()
+	case RecordEnd:
+		if r.End == nil {
+			return fmt.Errorf("end record has no end state")
+		}
+		for _, rels := range [][]*RelationshipRecord{r.End.Relationships, r.End.InitialRelationships} {
+			for _, rel := range rels {
+				if rel == nil {
+					return fmt.Errorf("end record has an empty relationship")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Validate は、メッセージに Kind に必要な内容がそろっているかを確かめます。
+// 発言や入退室など、ペルソナが行ったことを表すメッセージには送信者が必要です。
+func (r *MessageRecord) Validate() error {
+	switch r.Kind {
+	case message.KindCha, message.KindJoin, message.KindLeave, message.KindTyping, message.KindRelationship:
+		if r.From == "" {
+			return fmt.Errorf("%s message has no sender", r.Kind)
+		}
+	}
+	if r.Kind == message.KindRelationship && r.Relationship == nil {
+		return fmt.Errorf("relationship message has no relationship")
+	}
+	return nil
+}
+
+func (r *SessionRecord) toSession() *session.Session {
+	topics := make([]*topic.Topic, 0, len(r.Topics))
+	for _, t := range r.Topics {
+		topics = append(topics, &topic.Topic{
+			Title:     t.Title,
+			Summary:   t.Summary,
+			SourceURL: t.SourceURL,
+		})
+	}
+	return &session.Session{
+		ID:        r.ID,
+		StartedAt: r.StartedAt,
+		Topics:    topics,
+		Flags:     r.Flags,
+	}
+}
+
+// ToPersona は、レコードからペルソナを復元します。関係性は空です。
+func (r *PersonaRecord) ToPersona() *persona.Persona {
+	p := &persona.Persona{
+		PersonaId:            r.PersonaId,
+		DisplayName:          r.DisplayName,
+		Role:                 persona.Role(r.Role),
+		Gender:               r.Gender,
+		Tagline:              r.Tagline,
+		StyleTag:             r.StyleTag,
+		Catchphrases:         r.Catchphrases,
+		DefaultMaxChars:      r.DefaultMaxChars,
+		SpeakProb:            r.SpeakProb,
+		MinGapSeconds:        r.MinGapSeconds,
+		Relationships:        make(map[string]*persona.Relationship),
+		InitialRelationships: make(map[string]*persona.Relationship),
+	}
+	if v := r.Voice; v != nil {
+		p.Voice = persona.Voice{Name: v.Name, Rate: v.Rate, Pitch: v.Pitch}
+	}
+	return p
+}
+
+// ToMessage は、レコードからメッセージを復元します。from には、r.From が指すペルソナを渡します。
+func (r *MessageRecord) ToMessage(from *persona.Persona) *message.Message {
+	m := &message.Message{
+		ID:        r.ID,
+		Seq:       r.Seq,
+		SessionID: r.SessionID,
+		ReplyTo:   r.ReplyTo,
+		From:      from,
+		Kind:      r.Kind,
+		Text:      r.Text,
+		At:        r.At,
+	}
+	if r.Relationship != nil {
+		m.Relationship = r.Relationship.toRelationship()
+	}
+	return m
+}
+
+func (r *RelationshipRecord) toRelationship() *persona.Relationship {
+	return &persona.Relationship{
+		TargetPersonaId: r.TargetPersonaId,
+		Affinity:        r.Affinity,
+		Impression:      r.Impression,
+	}
+}
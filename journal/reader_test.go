@@ -0,0 +1,70 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	sessionLine = `{"type":"session","session":{"schemaVersion":1,"id":"20250101-120000","startedAt":"2025-01-01T03:00:00Z"}}`
+	personaLine = `{"type":"persona","persona":{"personaId":"aoi","displayName":"アオイ"}}`
+)
+
+// writeJournal は、lines を 1 行ずつ書いたジャーナルファイルを一時ディレクトリに作ります。
+func writeJournal(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatalf("write journal: %v", err)
+	}
+	return path
+}
+
+// TestReadFileCorruptLine は、種類に必要な内容が欠けたレコードを、パニックにせず行番号つきのエラーにすることを確かめます。
+func TestReadFileCorruptLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "session without session", line: `{"type":"session"}`},
+		{name: "session with null topic", line: `{"type":"session","session":{"schemaVersion":1,"topics":[null]}}`},
+		{name: "persona without persona", line: `{"type":"persona"}`},
+		{name: "persona without id", line: `{"type":"persona","persona":{"displayName":"名無し"}}`},
+		{name: "message without message", line: `{"type":"message"}`},
+		{name: "cha without sender", line: `{"type":"message","message":{"kind":"cha","text":"こんにちは"}}`},
+		{name: "relationship without relationship", line: `{"type":"message","message":{"kind":"relationship","from":"aoi"}}`},
+		{name: "end without end", line: `{"type":"end"}`},
+		{name: "end with null relationship", line: `{"type":"end","end":{"relationships":[null]}}`},
+		{name: "truncated line", line: `{"type":"message","message":{"kind":"cha","fr`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeJournal(t, sessionLine, personaLine, tt.line)
+			_, err := ReadFile(path)
+			if err == nil {
+				t.Fatal("ReadFile succeeded on a corrupt journal")
+			}
+			if !strings.Contains(err.Error(), "line 3") {
+				t.Errorf("error %q does not point at line 3", err)
+			}
+		})
+	}
+}
+
+// TestReadFileTruncated は、終了レコードのない途中までのジャーナルも読み込めることを確かめます。
+func TestReadFileTruncated(t *testing.T) {
+	path := writeJournal(t, sessionLine, personaLine,
+		`{"type":"message","message":{"kind":"cha","from":"aoi","text":"こんにちは","at":"2025-01-01T03:00:02Z"}}`)
+	j, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(j.Messages) != 1 || j.Messages[0].From == nil || j.Messages[0].From.PersonaId != "aoi" {
+		t.Errorf("got messages %v, want one from aoi", j.Messages)
+	}
+	if !j.EndedAt.IsZero() {
+		t.Errorf("got EndedAt %v, want zero", j.EndedAt)
+	}
+}
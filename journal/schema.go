@@ -0,0 +1,218 @@
+package journal
+
+import (
+	"time"
+
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/session"
+	"github.com/sat8bit/kaigi/transcript"
+)
+
+// SchemaVersion は、ジャーナルの形式のバージョンです。
+// フィールドの追加では変えず、既存のフィールドの意味や形を変えるときに上げます。
+const SchemaVersion = 1
+
+// RecordType は、ジャーナルの1行が表すレコードの種類です。
+type RecordType string
+
+const (
+	// RecordSession は、ファイルの先頭に1つだけ書かれる、セッションのメタデータです。
+	RecordSession RecordType = "session"
+	// RecordPersona は、ペルソナの静的な定義です。そのペルソナが最初に現れる前に書かれます。
+	RecordPersona RecordType = "persona"
+	// RecordMessage は、バスに流れたひとつのメッセージです。
+	RecordMessage RecordType = "message"
+	// RecordEnd は、ファイルの最後に1つだけ書かれる、セッション終了時の状態です。
+	RecordEnd RecordType = "end"
+)
+
+// Record は、ジャーナルの1行です。Type に対応するフィールドだけが設定されます。
+type Record struct {
+	Type    RecordType     `json:"type"`
+	Session *SessionRecord `json:"session,omitempty"`
+	Persona *PersonaRecord `json:"persona,omitempty"`
+	Message *MessageRecord `json:"message,omitempty"`
+	End     *EndRecord     `json:"end,omitempty"`
+}
+
+// SessionRecord は、セッションのメタデータです。
+type SessionRecord struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	ID            string            `json:"id"`
+	StartedAt     time.Time         `json:"startedAt"`
+	Topics        []*TopicRecord    `json:"topics"`
+	Flags         map[string]string `json:"flags"`
+}
+
+// TopicRecord は、セッションの話題です。
+type TopicRecord struct {
+	Title     string `json:"title"`
+	Summary   string `json:"summary"`
+	SourceURL string `json:"sourceUrl"`
+}
+
+// PersonaRecord は、ペルソナの静的な定義です。
+type PersonaRecord struct {
+	PersonaId       string   `json:"personaId"`
+	DisplayName     string   `json:"displayName"`
+	Role            string   `json:"role,omitempty"`
+	Gender          string   `json:"gender"`
+	Tagline         string   `json:"tagline"`
+	StyleTag        string   `json:"styleTag"`
+	Catchphrases    []string `json:"catchphrases"`
+	DefaultMaxChars int      `json:"defaultMaxChars"`
+	SpeakProb       float64  `json:"speakProb"`
+	MinGapSeconds   int      `json:"minGapSeconds"`
+	// Voice は、音声合成の設定です。設定のないペルソナでは省略されます。
+	Voice *VoiceRecord `json:"voice,omitempty"`
+}
+
+// VoiceRecord は、ペルソナの音声合成の設定です。
+type VoiceRecord struct {
+	Name  string  `json:"name,omitempty"`
+	Rate  float64 `json:"rate,omitempty"`
+	Pitch float64 `json:"pitch,omitempty"`
+}
+
+// MessageRecord は、バスに流れたひとつのメッセージです。
+// 送信者はペルソナへの参照ではなく、PersonaId で表します。
+type MessageRecord struct {
+	ID        string       `json:"id,omitempty"`
+	Seq       uint64       `json:"seq,omitempty"`
+	SessionID string       `json:"sessionId,omitempty"`
+	ReplyTo   string       `json:"replyTo,omitempty"`
+	Kind      message.Kind `json:"kind"`
+	// From は、送信者の PersonaId です。システムやログのメッセージでは空です。
+	From string    `json:"from,omitempty"`
+	Text string    `json:"text"`
+	At   time.Time `json:"at"`
+	// Relationship は、KindRelationship のときの更新後の関係性です。
+	Relationship *RelationshipRecord `json:"relationship,omitempty"`
+}
+
+// EndRecord は、セッション終了時の状態です。
+type EndRecord struct {
+	EndedAt       time.Time             `json:"endedAt"`
+	Relationships []*RelationshipRecord `json:"relationships"`
+	// InitialRelationships は、セッション開始時点の関係性です。古いジャーナルにはありません。
+	InitialRelationships []*RelationshipRecord `json:"initialRelationships,omitempty"`
+	// Changes は、このセッションで変わった関係性です。古いジャーナルにはありません。
+	Changes []*RelationshipChangeRecord `json:"changes,omitempty"`
+	// Editorial は、LLM が書いた記事のタイトルや要約です。書かせなかった場合と古いジャーナルにはありません。
+	Editorial *EditorialRecord `json:"editorial,omitempty"`
+}
+
+// EditorialRecord は、LLM が書いた記事のタイトル、要約、要点と小見出しです。
+type EditorialRecord struct {
+	Title     string                    `json:"title"`
+	Excerpt   []string                  `json:"excerpt,omitempty"`
+	Takeaways []string                  `json:"takeaways,omitempty"`
+	Sections  []*EditorialSectionRecord `json:"sections,omitempty"`
+}
+
+// EditorialSectionRecord は、会話の途中に入れる小見出しです。Index は、発言だけを数えた番号です。
+type EditorialSectionRecord struct {
+	Index   int    `json:"index"`
+	Heading string `json:"heading"`
+}
+
+func newEditorialRecord(e *session.Editorial) *EditorialRecord {
+	if e == nil {
+		return nil
+	}
+	r := &EditorialRecord{Title: e.Title, Excerpt: e.Excerpt, Takeaways: e.Takeaways}
+	for _, sec := range e.Sections {
+		r.Sections = append(r.Sections, &EditorialSectionRecord{Index: sec.Index, Heading: sec.Heading})
+	}
+	return r
+}
+
+func (r *EditorialRecord) toEditorial() *session.Editorial {
+	if r == nil {
+		return nil
+	}
+	e := &session.Editorial{Title: r.Title, Excerpt: r.Excerpt, Takeaways: r.Takeaways}
+	for _, sec := range r.Sections {
+		e.Sections = append(e.Sections, &session.EditorialSection{Index: sec.Index, Heading: sec.Heading})
+	}
+	return e
+}
+
+// RelationshipRecord は、あるペルソナから見た別のペルソナへの関係性です。
+type RelationshipRecord struct {
+	PersonaId       string `json:"personaId"`
+	TargetPersonaId string `json:"targetPersonaId"`
+	Affinity        int    `json:"affinity"`
+	Impression      string `json:"impression"`
+}
+
+// RelationshipChangeRecord は、PersonaId から見た関係性の、セッションの前後での変化です。
+// 変化の項目は json レンダラーの記録と共通です。
+type RelationshipChangeRecord struct {
+	PersonaId string `json:"personaId"`
+	*transcript.RelationshipChange
+}
+
+func newSessionRecord(s *session.Session) *SessionRecord {
+	topics := make([]*TopicRecord, 0, len(s.Topics))
+	for _, t := range s.Topics {
+		topics = append(topics, &TopicRecord{
+			Title:     t.Title,
+			Summary:   t.Summary,
+			SourceURL: t.SourceURL,
+		})
+	}
+	return &SessionRecord{
+		SchemaVersion: SchemaVersion,
+		ID:            s.ID,
+		StartedAt:     s.StartedAt,
+		Topics:        topics,
+		Flags:         s.Flags,
+	}
+}
+
+// NewPersonaRecord は、ペルソナの静的な定義をレコードにします。関係性は含みません。
+func NewPersonaRecord(p *persona.Persona) *PersonaRecord {
+	r := &PersonaRecord{
+		PersonaId:       p.PersonaId,
+		DisplayName:     p.DisplayName,
+		Role:            string(p.Role),
+		Gender:          p.Gender,
+		Tagline:         p.Tagline,
+		StyleTag:        p.StyleTag,
+		Catchphrases:    p.Catchphrases,
+		DefaultMaxChars: p.DefaultMaxChars,
+		SpeakProb:       p.SpeakProb,
+		MinGapSeconds:   p.MinGapSeconds,
+	}
+	if p.Voice != (persona.Voice{}) {
+		r.Voice = &VoiceRecord{Name: p.Voice.Name, Rate: p.Voice.Rate, Pitch: p.Voice.Pitch}
+	}
+	return r
+}
+
+// NewMessageRecord は、メッセージをレコードにします。送信者は PersonaId で参照します。
+func NewMessageRecord(m *message.Message) *MessageRecord {
+	r := &MessageRecord{
+		ID:        m.ID,
+		Seq:       m.Seq,
+		SessionID: m.SessionID,
+		ReplyTo:   m.ReplyTo,
+		Kind:      m.Kind,
+		Text:      m.Text,
+		At:        m.At,
+	}
+	if m.From != nil {
+		r.From = m.From.PersonaId
+	}
+	if m.Relationship != nil {
+		r.Relationship = &RelationshipRecord{
+			PersonaId:       r.From,
+			TargetPersonaId: m.Relationship.TargetPersonaId,
+			Affinity:        m.Relationship.Affinity,
+			Impression:      m.Relationship.Impression,
+		}
+	}
+	return r
+}
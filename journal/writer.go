@@ -0,0 +1,170 @@
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	buspkg "github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/session"
+	"github.com/sat8bit/kaigi/transcript"
+)
+
+// Writer は、バスに流れたすべてのメッセージを、セッションごとの JSONL ファイルに書き出します。
+// レンダラーと同じく Render で購読を始め、Finalize でセッション終了時の状態を書いて閉じます。
+type Writer struct {
+	dir           string
+	dramaticSwing int
+	session       *session.Session
+
+	mu       sync.Mutex
+	file     *os.File
+	encoder  *json.Encoder
+	personas map[string]bool
+}
+
+// NewWriter は、dir に <セッションID>.jsonl を書き出す Writer を生成します。
+func NewWriter(dir string, dramaticSwing int) *Writer {
+	return &Writer{
+		dir:           dir,
+		dramaticSwing: dramaticSwing,
+		personas:      make(map[string]bool),
+	}
+}
+
+// Path は、ジャーナルファイルのパスを返します。Render を呼び出した後に使います。
+func (w *Writer) Path() string {
+	return filepath.Join(w.dir, w.session.ID+".jsonl")
+}
+
+// Render は、ジャーナルファイルを作成し、バスの購読を開始します。
+func (w *Writer) Render(ctx context.Context, sess *session.Session, b buspkg.Bus, wg *sync.WaitGroup) error {
+	w.session = sess
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	f, err := os.Create(w.Path())
+	if err != nil {
+		return fmt.Errorf("failed to create journal file: %w", err)
+	}
+	w.file = f
+	w.encoder = json.NewEncoder(f)
+
+	if err := w.write(&Record{Type: RecordSession, Session: newSessionRecord(w.session)}); err != nil {
+		return err
+	}
+
+	// ジャーナルはログも含めてすべて残したいので、大きめのバッファで待つようにします。
+	messageCh := b.Subscribe(
+		buspkg.WithName("journal"),
+		buspkg.WithBufferSize(1024),
+		buspkg.WithPolicy(buspkg.PolicyBlock),
+		buspkg.WithBlockTimeout(time.Second),
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for msg := range messageCh {
+			if err := w.writeMessage(msg); err != nil {
+				slog.Error("failed to write journal record", "error", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Finalize は、セッション終了時の関係性と、セッションの前後での変化を書き出し、ファイルを閉じます。
+// LLM が書いた記事のタイトルなどがセッションにあれば、あわせて書き出します。
+// それを書かせるレンダラーより後に Finalize を呼び出します。
+func (w *Writer) Finalize(ctx context.Context, sess *session.Session) error {
+	if w.file == nil {
+		return nil
+	}
+	defer w.file.Close()
+
+	end := &EndRecord{EndedAt: sess.EndedAt, Editorial: newEditorialRecord(sess.Editorial)}
+	if end.EndedAt.IsZero() {
+		end.EndedAt = time.Now()
+	}
+	for _, p := range sess.Participants {
+		if err := w.writePersona(p); err != nil {
+			return err
+		}
+		end.Relationships = append(end.Relationships, relationshipRecords(p.PersonaId, p.Relationships)...)
+		end.InitialRelationships = append(end.InitialRelationships, relationshipRecords(p.PersonaId, p.InitialRelationships)...)
+		for _, c := range p.RelationshipChanges(w.dramaticSwing) {
+			end.Changes = append(end.Changes, &RelationshipChangeRecord{
+				PersonaId:          p.PersonaId,
+				RelationshipChange: transcript.NewRelationshipChange(c),
+			})
+		}
+	}
+
+	if err := w.write(&Record{Type: RecordEnd, End: end}); err != nil {
+		return err
+	}
+
+	slog.Info("Journal written", "path", w.Path())
+	return nil
+}
+
+func (w *Writer) writeMessage(m *message.Message) error {
+	if m.From != nil {
+		if err := w.writePersona(m.From); err != nil {
+			return err
+		}
+	}
+	return w.write(&Record{Type: RecordMessage, Message: NewMessageRecord(m)})
+}
+
+// writePersona は、まだ書いていないペルソナであれば、その定義を書き出します。
+func (w *Writer) writePersona(p *persona.Persona) error {
+	w.mu.Lock()
+	written := w.personas[p.PersonaId]
+	w.personas[p.PersonaId] = true
+	w.mu.Unlock()
+
+	if written {
+		return nil
+	}
+	return w.write(&Record{Type: RecordPersona, Persona: NewPersonaRecord(p)})
+}
+
+func (w *Writer) write(r *Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.encoder.Encode(r); err != nil {
+		return fmt.Errorf("failed to write %s record: %w", r.Type, err)
+	}
+	return nil
+}
+
+func relationshipRecords(personaId string, rels map[string]*persona.Relationship) []*RelationshipRecord {
+	targetIds := make([]string, 0, len(rels))
+	for id := range rels {
+		targetIds = append(targetIds, id)
+	}
+	sort.Strings(targetIds)
+
+	records := make([]*RelationshipRecord, 0, len(targetIds))
+	for _, id := range targetIds {
+		rel := rels[id]
+		records = append(records, &RelationshipRecord{
+			PersonaId:       personaId,
+			TargetPersonaId: rel.TargetPersonaId,
+			Affinity:        rel.Affinity,
+			Impression:      rel.Impression,
+		})
+	}
+	return records
+}
@@ -0,0 +1,102 @@
+package journal
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/session"
+	"github.com/sat8bit/kaigi/topic"
+)
+
+// TestWriterRoundTrip は、Writer が書いたジャーナルを ReadFile で読み戻すと、会話と関係性が元どおりになることを確かめます。
+func TestWriterRoundTrip(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	aoi := &persona.Persona{
+		PersonaId:            "aoi",
+		DisplayName:          "アオイ",
+		Relationships:        map[string]*persona.Relationship{"haru": {TargetPersonaId: "haru", Affinity: 40, Impression: "楽しい人"}},
+		InitialRelationships: map[string]*persona.Relationship{"haru": {TargetPersonaId: "haru", Affinity: 10, Impression: "初対面"}},
+	}
+	haru := &persona.Persona{PersonaId: "haru", DisplayName: "ハル"}
+	sess := session.New(start, []*topic.Topic{{Title: `A "quoted" title`, SourceURL: "https://example.com"}}, nil)
+
+	b := bus.NewMemoryBus(bus.WithSessionID(sess.ID))
+	w := NewWriter(t.TempDir(), persona.DefaultDramaticSwing)
+	var wg sync.WaitGroup
+	if err := w.Render(context.Background(), sess, b, &wg); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	sent := []*message.Message{
+		{Kind: message.KindJoin, From: aoi, Text: "アオイ が参加しました。", At: start.Add(time.Second)},
+		{Kind: message.KindJoin, From: haru, Text: "ハル が参加しました。", At: start.Add(time.Second)},
+		{Kind: message.KindCha, From: aoi, Text: "こんにちは", At: start.Add(2 * time.Second)},
+		{Kind: message.KindCha, From: haru, Text: "いい天気ですね", At: start.Add(3 * time.Second)},
+		{Kind: message.KindRelationship, From: aoi, Relationship: aoi.Relationships["haru"], At: start.Add(4 * time.Second)},
+		{Kind: message.KindEnd, Text: string(session.EndMaxTurns), At: start.Add(5 * time.Second)},
+	}
+	for _, m := range sent {
+		if err := b.Broadcast(m); err != nil {
+			t.Fatalf("broadcast: %v", err)
+		}
+	}
+	b.Close()
+	wg.Wait()
+	sess.End(start.Add(5*time.Second), session.EndMaxTurns, []*persona.Persona{aoi, haru}, session.Stats{})
+	if err := w.Finalize(context.Background(), sess); err != nil {
+		t.Fatalf("finalize: %v", err)
+	}
+
+	j, err := ReadFile(w.Path())
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if j.Session.ID != sess.ID || j.Session.Topics[0].Title != sess.Topics[0].Title {
+		t.Errorf("got session %s %q, want %s %q", j.Session.ID, j.Session.Topics[0].Title, sess.ID, sess.Topics[0].Title)
+	}
+	if j.Session.EndReason != session.EndMaxTurns {
+		t.Errorf("got end reason %q, want %q", j.Session.EndReason, session.EndMaxTurns)
+	}
+	if !j.EndedAt.Equal(sess.EndedAt) {
+		t.Errorf("got EndedAt %v, want %v", j.EndedAt, sess.EndedAt)
+	}
+	if got := j.Session.Stats.BySpeaker["aoi"]; got != 1 {
+		t.Errorf("got %d utterances from aoi, want 1", got)
+	}
+
+	if len(j.Messages) != len(sent) {
+		t.Fatalf("got %d messages, want %d", len(j.Messages), len(sent))
+	}
+	for i, got := range j.Messages {
+		want := sent[i]
+		if got.Kind != want.Kind || got.Text != want.Text || got.Seq != want.Seq || got.ID != want.ID || !got.At.Equal(want.At) {
+			t.Errorf("message %d: got %+v, want %+v", i, got, want)
+		}
+		if (got.From == nil) != (want.From == nil) || (got.From != nil && got.From.PersonaId != want.From.PersonaId) {
+			t.Errorf("message %d: got sender %v, want %v", i, got.From, want.From)
+		}
+	}
+	if rel := j.Messages[4].Relationship; rel == nil || rel.Affinity != 40 || rel.TargetPersonaId != "haru" {
+		t.Errorf("got relationship %+v, want affinity 40 towards haru", rel)
+	}
+
+	var restored *persona.Persona
+	for _, p := range j.Personas {
+		if p.PersonaId == "aoi" {
+			restored = p
+		}
+	}
+	if restored == nil {
+		t.Fatal("aoi was not restored")
+	}
+	if rel := restored.Relationships["haru"]; rel == nil || rel.Affinity != 40 || rel.Impression != "楽しい人" {
+		t.Errorf("got relationship %+v, want affinity 40", rel)
+	}
+	if rel := restored.InitialRelationships["haru"]; rel == nil || rel.Affinity != 10 {
+		t.Errorf("got initial relationship %+v, want affinity 10", rel)
+	}
+}
@@ -5,13 +5,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/metrics"
 	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/session"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/genai"
 )
 
+var tracer = otel.Tracer("github.com/sat8bit/kaigi/llm")
+
 func NewGemini(ctx context.Context, projectId, location, model string) *Gemini {
 	client, err := genai.NewClient(ctx, &genai.ClientConfig{
 		Project:  projectId,
@@ -38,7 +48,7 @@ func (g *Gemini) messagesToContents(personaId string, messages []*message.Messag
 	for _, msg := range messages {
 		role := genai.RoleUser
 		switch msg.Kind {
-		case message.KindSystem:
+		case message.KindSystem, message.KindJoin, message.KindLeave:
 			contents = append(contents, &genai.Content{
 				Role:  role,
 				Parts: []*genai.Part{{Text: fmt.Sprintf("%s", msg.Text)}},
@@ -76,7 +86,7 @@ func (g *Gemini) Generate(ctx context.Context, input GenerateInput) (string, err
 		},
 	}
 
-	resp, err := g.client.Models.GenerateContent(ctx, g.model, contents, cfg)
+	resp, err := g.generateContent(ctx, "Generate", input.Persona.PersonaId, contents, cfg)
 	if err != nil {
 		return "", fmt.Errorf("llm.Gemini.Generate: %w", err)
 	}
@@ -109,7 +119,9 @@ func (g *Gemini) UpdateRelationship(ctx context.Context, input *UpdateRelationsh
 		},
 	}
 
-	resp, err := g.client.Models.GenerateContent(ctx, g.model, contents, cfg)
+	resp, err := g.generateContent(ctx, "UpdateRelationship", input.Persona.PersonaId, contents, cfg,
+		attribute.String("kaigi.target_persona.id", input.TargetPersona.PersonaId),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("llm.Gemini.UpdateRelationship: %w", err)
 	}
@@ -136,6 +148,307 @@ func (g *Gemini) UpdateRelationship(ctx context.Context, input *UpdateRelationsh
 	return newRel, nil
 }
 
+func (g *Gemini) Moderate(ctx context.Context, input *ModerateInput) (*ModerateResult, error) {
+	var temp float32 = 0
+	cfg := &genai.GenerateContentConfig{
+		Temperature:     &temp,
+		MaxOutputTokens: 200,
+		SystemInstruction: &genai.Content{
+			Role:  genai.RoleUser,
+			Parts: []*genai.Part{{Text: buildModerationSystemPrompt()}},
+		},
+		ResponseMIMEType: "application/json",
+		ResponseSchema: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"flagged":    {Type: genai.TypeBoolean},
+				"categories": {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+				"reason":     {Type: genai.TypeString},
+			},
+		},
+	}
+
+	contents := []*genai.Content{{
+		Role:  genai.RoleUser,
+		Parts: []*genai.Part{{Text: fmt.Sprintf("Speaker: %s\nUtterance: %s", input.Speaker.DisplayName, input.Text)}},
+	}}
+
+	resp, err := g.generateContent(ctx, "Moderate", input.Speaker.PersonaId, contents, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("llm.Gemini.Moderate: %w", err)
+	}
+
+	rawJson := extractText(resp)
+	if rawJson == "" {
+		return nil, fmt.Errorf("LLM returned empty response for moderation")
+	}
+
+	var parsedResp struct {
+		Flagged    bool     `json:"flagged"`
+		Categories []string `json:"categories"`
+		Reason     string   `json:"reason"`
+	}
+	if err := json.Unmarshal([]byte(rawJson), &parsedResp); err != nil {
+		return nil, fmt.Errorf("failed to parse moderation response: %w. raw response: %s", err, rawJson)
+	}
+
+	return &ModerateResult{
+		Flagged:    parsedResp.Flagged,
+		Categories: parsedResp.Categories,
+		Reason:     parsedResp.Reason,
+	}, nil
+}
+
+func (g *Gemini) AnalyzeEmotions(ctx context.Context, input *EmotionInput) ([]*Emotion, error) {
+	var temp float32 = 0
+	cfg := &genai.GenerateContentConfig{
+		Temperature: &temp,
+		SystemInstruction: &genai.Content{
+			Role:  genai.RoleUser,
+			Parts: []*genai.Part{{Text: buildEmotionSystemPrompt()}},
+		},
+		ResponseMIMEType: "application/json",
+		ResponseSchema: &genai.Schema{
+			Type: genai.TypeArray,
+			Items: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"index":     {Type: genai.TypeInteger},
+					"emotion":   {Type: genai.TypeString, Enum: Emotions},
+					"intensity": {Type: genai.TypeNumber},
+				},
+			},
+		},
+	}
+
+	var utterances strings.Builder
+	for i, msg := range input.Messages {
+		utterances.WriteString(fmt.Sprintf("%d. %s: %s\n", i, msg.From.DisplayName, msg.Text))
+	}
+	contents := []*genai.Content{{
+		Role:  genai.RoleUser,
+		Parts: []*genai.Part{{Text: utterances.String()}},
+	}}
+
+	resp, err := g.generateContent(ctx, "AnalyzeEmotions", "", contents, cfg,
+		attribute.Int("kaigi.utterances", len(input.Messages)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("llm.Gemini.AnalyzeEmotions: %w", err)
+	}
+
+	rawJson := extractText(resp)
+	if rawJson == "" {
+		return nil, fmt.Errorf("LLM returned empty response for emotion analysis")
+	}
+
+	var parsedResp []struct {
+		Index     int     `json:"index"`
+		Emotion   string  `json:"emotion"`
+		Intensity float64 `json:"intensity"`
+	}
+	if err := json.Unmarshal([]byte(rawJson), &parsedResp); err != nil {
+		return nil, fmt.Errorf("failed to parse emotion response: %w. raw response: %s", err, rawJson)
+	}
+
+	// 判定が抜けた発言は、平静として扱います。
+	emotions := make([]*Emotion, len(input.Messages))
+	for i := range emotions {
+		emotions[i] = &Emotion{Label: EmotionNeutral}
+	}
+	for _, e := range parsedResp {
+		if e.Index < 0 || e.Index >= len(emotions) {
+			continue
+		}
+		emotions[e.Index] = &Emotion{Label: e.Emotion, Intensity: min(max(e.Intensity, 0), 1)}
+	}
+	return emotions, nil
+}
+
+func (g *Gemini) EditPost(ctx context.Context, input *EditorialInput) (*session.Editorial, error) {
+	var temp float32 = 0.7
+	cfg := &genai.GenerateContentConfig{
+		Temperature: &temp,
+		SystemInstruction: &genai.Content{
+			Role:  genai.RoleUser,
+			Parts: []*genai.Part{{Text: buildEditorialSystemPrompt()}},
+		},
+		ResponseMIMEType: "application/json",
+		ResponseSchema: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"title":     {Type: genai.TypeString},
+				"excerpt":   {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+				"takeaways": {Type: genai.TypeArray, Items: &genai.Schema{Type: genai.TypeString}},
+				"sections": {
+					Type: genai.TypeArray,
+					Items: &genai.Schema{
+						Type: genai.TypeObject,
+						Properties: map[string]*genai.Schema{
+							"index":   {Type: genai.TypeInteger},
+							"heading": {Type: genai.TypeString},
+						},
+						Required: []string{"index", "heading"},
+					},
+				},
+			},
+			Required: []string{"title", "excerpt", "takeaways", "sections"},
+		},
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString("## Topics\n")
+	for _, t := range input.Topics {
+		prompt.WriteString(fmt.Sprintf("- %s: %s\n", t.Title, oneLine(t.Summary)))
+	}
+	prompt.WriteString("\n## Utterances\n")
+	for i, msg := range input.Messages {
+		prompt.WriteString(fmt.Sprintf("%d. %s: %s\n", i, msg.From.DisplayName, msg.Text))
+	}
+	contents := []*genai.Content{{
+		Role:  genai.RoleUser,
+		Parts: []*genai.Part{{Text: prompt.String()}},
+	}}
+
+	resp, err := g.generateContent(ctx, "EditPost", "", contents, cfg,
+		attribute.Int("kaigi.utterances", len(input.Messages)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("llm.Gemini.EditPost: %w", err)
+	}
+
+	rawJson := extractText(resp)
+	if rawJson == "" {
+		return nil, fmt.Errorf("LLM returned empty response for post editorial")
+	}
+
+	var parsedResp struct {
+		Title     string   `json:"title"`
+		Excerpt   []string `json:"excerpt"`
+		Takeaways []string `json:"takeaways"`
+		Sections  []struct {
+			Index   int    `json:"index"`
+			Heading string `json:"heading"`
+		} `json:"sections"`
+	}
+	if err := json.Unmarshal([]byte(rawJson), &parsedResp); err != nil {
+		return nil, fmt.Errorf("failed to parse editorial response: %w. raw response: %s", err, rawJson)
+	}
+
+	e := &session.Editorial{Title: oneLine(parsedResp.Title)}
+	if e.Title == "" {
+		return nil, fmt.Errorf("LLM returned an empty title. raw response: %s", rawJson)
+	}
+	for _, line := range parsedResp.Excerpt {
+		if line = oneLine(line); line != "" && len(e.Excerpt) < 2 {
+			e.Excerpt = append(e.Excerpt, line)
+		}
+	}
+	for _, t := range parsedResp.Takeaways {
+		if t = oneLine(t); t != "" {
+			e.Takeaways = append(e.Takeaways, t)
+		}
+	}
+	// 範囲外の位置や、同じ発言の前に重なった小見出しは捨てます。
+	seen := make(map[int]bool)
+	for _, sec := range parsedResp.Sections {
+		heading := oneLine(sec.Heading)
+		if heading == "" || sec.Index < 0 || sec.Index >= len(input.Messages) || seen[sec.Index] {
+			continue
+		}
+		seen[sec.Index] = true
+		e.Sections = append(e.Sections, &session.EditorialSection{Index: sec.Index, Heading: heading})
+	}
+	sort.Slice(e.Sections, func(i, j int) bool {
+		return e.Sections[i].Index < e.Sections[j].Index
+	})
+	return e, nil
+}
+
+// generateContent は、モデルを呼び出し、その呼び出しをスパンとメトリクスに記録します。
+// スパンには、モデル名とトークン数が属性として付きます。
+func (g *Gemini) generateContent(ctx context.Context, operation, personaId string, contents []*genai.Content, cfg *genai.GenerateContentConfig, attrs ...attribute.KeyValue) (*genai.GenerateContentResponse, error) {
+	ctx, span := tracer.Start(ctx, "llm."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("kaigi.persona.id", personaId),
+		attribute.String("gen_ai.system", "vertex_ai"),
+		attribute.String("gen_ai.request.model", g.model),
+	)
+
+	start := time.Now()
+	resp, err := g.client.Models.GenerateContent(ctx, g.model, contents, cfg)
+	metrics.LLMRequestDuration.WithLabelValues(operation, g.model).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.Errors.WithLabelValues(metrics.ErrorLLM).Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	if u := resp.UsageMetadata; u != nil {
+		span.SetAttributes(
+			attribute.Int("gen_ai.usage.input_tokens", int(u.PromptTokenCount)),
+			attribute.Int("gen_ai.usage.output_tokens", int(u.CandidatesTokenCount)),
+			attribute.Int("gen_ai.usage.total_tokens", int(u.TotalTokenCount)),
+		)
+		metrics.LLMTokens.WithLabelValues(personaId, operation, "input").Add(float64(u.PromptTokenCount))
+		metrics.LLMTokens.WithLabelValues(personaId, operation, "output").Add(float64(u.CandidatesTokenCount))
+	}
+	return resp, nil
+}
+
+func buildModerationSystemPrompt() string {
+	var p strings.Builder
+
+	p.WriteString("You are a content moderator for a public blog that publishes conversations between AI characters.\n")
+	p.WriteString("Some characters are intentionally provocative or sarcastic; that alone is acceptable.\n\n")
+	p.WriteString("## Your Task\n")
+	p.WriteString("Decide whether the given utterance is unsafe to publish. Flag it only if it contains any of the following:\n")
+	p.WriteString("- harassment or hate speech targeting a protected group\n")
+	p.WriteString("- personal attacks or defamation against a real, identifiable person\n")
+	p.WriteString("- personal information such as addresses, phone numbers or e-mail addresses\n")
+	p.WriteString("- sexual content, violence, self-harm or encouragement of illegal acts\n\n")
+	p.WriteString("## Output Specification\n")
+	p.WriteString("Your response must be a valid JSON object conforming to the specified schema.\n")
+	p.WriteString("- `flagged`: true if the utterance must not be published.\n")
+	p.WriteString("- `categories`: short English labels of the violated categories. Empty if not flagged.\n")
+	p.WriteString("- `reason`: a one-sentence explanation in Japanese. Empty if not flagged.\n")
+
+	return p.String()
+}
+
+func buildEmotionSystemPrompt() string {
+	var p strings.Builder
+
+	p.WriteString("You are a voice director preparing a script for a text-to-speech engine.\n\n")
+	p.WriteString("## Your Task\n")
+	p.WriteString("You are given a numbered list of utterances from a conversation. For every utterance, decide the emotion the speaker should convey when it is read aloud, considering the flow of the conversation.\n\n")
+	p.WriteString("## Output Specification\n")
+	p.WriteString("Your response must be a valid JSON array conforming to the specified schema, with one object per utterance.\n")
+	p.WriteString("- `index`: the number of the utterance.\n")
+	p.WriteString(fmt.Sprintf("- `emotion`: one of %s. Use `neutral` when no emotion stands out.\n", strings.Join(Emotions, ", ")))
+	p.WriteString("- `intensity`: how strongly the emotion is expressed, from 0.0 to 1.0.\n")
+
+	return p.String()
+}
+
+func buildEditorialSystemPrompt() string {
+	var p strings.Builder
+
+	p.WriteString("You are the editor of a Japanese blog that publishes casual conversations between AI characters about news articles.\n\n")
+	p.WriteString("## Your Task\n")
+	p.WriteString("You are given the news topics and a numbered list of utterances from one conversation. Write the headline material for the blog post, in Japanese.\n")
+	p.WriteString("Base everything on what was actually said; do not invent facts or quotes.\n\n")
+	p.WriteString("## Output Specification\n")
+	p.WriteString("Your response must be a valid JSON object conforming to the specified schema.\n")
+	p.WriteString("- `title`: a catchy title of at most 40 characters that makes readers want to open the post. Do not simply repeat the news headline.\n")
+	p.WriteString("- `excerpt`: exactly two short sentences, one per element, summarizing the conversation for the list page.\n")
+	p.WriteString("- `takeaways`: three to five key points of the conversation, each one sentence.\n")
+	p.WriteString("- `sections`: optional section breaks where the conversation clearly shifts to another subject. `index` is the number of the first utterance of the new section and `heading` is a short heading for it. Use an empty array if the conversation stays on one subject.\n")
+
+	return p.String()
+}
+
 func buildRelationshipSystemPrompt(input *UpdateRelationshipInput) string {
 	var p strings.Builder
 
@@ -268,3 +581,6 @@ func oneLine(s string) string {
 }
 
 var _ LLM = &Gemini{}
+var _ Moderator = &Gemini{}
+var _ EmotionAnalyzer = &Gemini{}
+var _ Editor = &Gemini{}
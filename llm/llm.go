@@ -5,6 +5,7 @@ import (
 
 	"github.com/sat8bit/kaigi/message"
 	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/session"
 	"github.com/sat8bit/kaigi/topic"
 )
 
@@ -34,3 +35,67 @@ type GenerateInput struct {
 	Topics         []*topic.Topic
 	Relationships  map[string]*persona.Relationship // 他の参加者への関係性一覧
 }
+
+// ModerateInput は、発言内容の安全性を判定する際にLLMに渡す入力です。
+type ModerateInput struct {
+	Speaker *persona.Persona
+	Text    string
+}
+
+// ModerateResult は、発言内容の安全性の判定結果です。
+type ModerateResult struct {
+	Flagged    bool
+	Categories []string
+	Reason     string
+}
+
+// Moderator は、発言内容が公開に適しているかを判定するLLMです。
+type Moderator interface {
+	Moderate(context.Context, *ModerateInput) (*ModerateResult, error)
+}
+
+// 発言の感情のラベルです。
+const (
+	EmotionNeutral  = "neutral"
+	EmotionJoy      = "joy"
+	EmotionSadness  = "sadness"
+	EmotionAnger    = "anger"
+	EmotionSurprise = "surprise"
+	EmotionFear     = "fear"
+)
+
+// Emotions は、EmotionAnalyzer が返す感情のラベルの一覧です。
+var Emotions = []string{EmotionNeutral, EmotionJoy, EmotionSadness, EmotionAnger, EmotionSurprise, EmotionFear}
+
+// EmotionInput は、発言の感情を判定する際にLLMに渡す入力です。
+type EmotionInput struct {
+	// Messages は、判定する発言です。会話の順に並べます。
+	Messages []*message.Message
+}
+
+// Emotion は、ひとつの発言に込められた感情です。
+type Emotion struct {
+	// Label は、Emotions のいずれかです。
+	Label string
+	// Intensity は、感情の強さです (0〜1)。
+	Intensity float64
+}
+
+// EmotionAnalyzer は、構造化出力を使って発言ごとの感情を判定するLLMです。
+type EmotionAnalyzer interface {
+	// AnalyzeEmotions は、input.Messages と同じ順番・同じ数の感情を返します。
+	AnalyzeEmotions(context.Context, *EmotionInput) ([]*Emotion, error)
+}
+
+// EditorialInput は、会話を記事にする際に、タイトルや要約を書くためにLLMに渡す入力です。
+type EditorialInput struct {
+	Topics []*topic.Topic
+	// Messages は、記事に載せる発言です。会話の順に並べます。
+	Messages []*message.Message
+}
+
+// Editor は、構造化出力を使って、会話の記事のタイトルや要約を書くLLMです。
+type Editor interface {
+	// EditPost の小見出しの位置 (session.EditorialSection.Index) は、input.Messages の添字です。
+	EditPost(context.Context, *EditorialInput) (*session.Editorial, error)
+}
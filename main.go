@@ -2,13 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
 	"math/rand"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
@@ -18,134 +21,407 @@ import (
 	"github.com/sat8bit/kaigi/buslog"
 	"github.com/sat8bit/kaigi/cha"
 	"github.com/sat8bit/kaigi/fetcher"
+	"github.com/sat8bit/kaigi/human"
+	"github.com/sat8bit/kaigi/journal"
 	"github.com/sat8bit/kaigi/llm"
 	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/metrics"
+	"github.com/sat8bit/kaigi/moderation"
+	"github.com/sat8bit/kaigi/netbus"
 	"github.com/sat8bit/kaigi/persona"
 	"github.com/sat8bit/kaigi/renderer"
+	"github.com/sat8bit/kaigi/roster"
+	"github.com/sat8bit/kaigi/session"
 	"github.com/sat8bit/kaigi/supervisor"
 	"github.com/sat8bit/kaigi/topic"
+	"github.com/sat8bit/kaigi/tracing"
 	"github.com/sat8bit/kaigi/turn"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/sat8bit/kaigi")
+
+// --- フラグ定義 ---
+var (
+	maxTurns      = flag.Int("turns", 20, "Maximum number of turns before shutdown")
+	personaIDsStr = flag.String("chas", "", "Comma-separated list of persona IDs to participate (e.g., aoi,haru,gou)")
+	numChas       = flag.Int("num-chas", 3, "Number of random Chas to participate (used if -chas is not provided); 0 runs no Chas, e.g. for a renderer-only process joining with -bus-addr")
+	renderersStr  = flag.String("renderers", "console", "Comma-separated list of renderers to use ("+strings.Join(renderer.Names(), ", ")+")")
+	rssURL        = flag.String("rss-url", "", "URL of the RSS feed to use as a topic")
+	rssLimit      = flag.Int("rss-limit", 1, "Maximum number of RSS items to fetch")
+	dataDir       = flag.String("data", "./data", "Directory for dynamic data like relationships")
+	noSave        = flag.Bool("no-save", false, "If true, relationship data will not be saved to files")
+	humanPath     = flag.String("human", "", "Path to a persona YAML file for a human participant typing from the terminal")
+	humanSocket   = flag.String("human-socket", "", "Unix socket path to read the human participant's lines from (default: stdin)")
+	modRulesPath  = flag.String("moderation-rules", "", "Path to a YAML file of moderation rules (blocked words, PII, length limits, regex)")
+	modLLM        = flag.Bool("moderation-llm", false, "If true, also classify each utterance with the LLM before broadcasting")
+	modAction     = flag.String("moderation-action", "regenerate", "What to do with an utterance that violates moderation rules (regenerate, redact, drop)")
+	modRetries    = flag.Int("moderation-retries", 2, "Maximum number of regenerations before dropping an utterance")
+	modReportDir  = flag.String("moderation-report", "./data/moderation", "Directory to save the moderation report of each session")
+	busBuffer     = flag.Int("bus-buffer", 16, "Default per-subscriber buffer size of the message bus")
+	busPolicy     = flag.String("bus-policy", "drop-newest", "What to do with non-critical messages when a subscriber's buffer is full (drop-newest, drop-oldest, block)")
+	busTimeout    = flag.Duration("bus-block-timeout", 100*time.Millisecond, "How long the block policy waits for buffer space before dropping")
+	busListen     = flag.String("bus-listen", "", "Address to expose this session's bus on, so participants in other processes can join with -bus-addr")
+	busAddr       = flag.String("bus-addr", "", "Address of a bus hub (kaigi hub or another session's -bus-listen) to connect to instead of an in-process bus")
+	busHost       = flag.Bool("bus-host", false, "With -bus-addr, end the session and announce the participants from this process; exactly one process of a shared session must be the host (a process with -bus-listen always is)")
+	logLevel      = flag.String("log-level", "info", "Minimum level of logs shown on the bus and written to -log-file (debug, info, warn, error)")
+	logFile       = flag.String("log-file", "", "File to also write logs to, or - for stderr (empty to disable)")
+	logFormat     = flag.String("log-format", "text", "Format of the logs written to -log-file (text, json)")
+	traceFile     = flag.String("trace-file", "", "File to write OpenTelemetry traces to as JSON (empty to disable)")
+	traceOTLP     = flag.String("trace-otlp", "", "OTLP/HTTP endpoint URL to send OpenTelemetry traces to, e.g. http://localhost:4318 (empty to disable)")
+	journalDir    = flag.String("journal", "./data/journal", "Directory to save the JSONL journal of all bus traffic (empty to disable)")
+	editorial     = flag.Bool("editorial", false, "If true, ask the LLM for a catchy title, a two-line excerpt, key takeaways and section headings at topic shifts for markdown posts")
+	voiceEmotion  = flag.Bool("voice-emotion", false, "If true, ask the LLM for the emotion of each utterance and add prosody hints to the voice script")
+	webAddr       = flag.String("web-addr", ":8080", "Address for the web renderer to serve the live viewer on")
+	metricsAddr   = flag.String("metrics-addr", "", "Address to serve Prometheus metrics on at /metrics (empty to disable)")
+	every         = flag.Duration("every", 0, "Start a new session at this interval, counted from the start of the previous one, until interrupted (daemon mode); 0 runs a single session")
+	scheduleStr   = flag.String("schedule", "", "Comma-separated join/leave schedule (e.g., join:sou@10,leave:gou@15,join:haru@mention)")
+
+	// レンダラーの設定は、kaigi render と共通です。
+	renderFlags = registerRendererFlags(flag.CommandLine)
 )
 
 func main() {
 	rand.Seed(time.Now().UnixNano())
 
-	// --- フラグ定義 ---
-	var (
-		maxTurns      = flag.Int("turns", 20, "Maximum number of turns before shutdown")
-		personaIDsStr = flag.String("chas", "", "Comma-separated list of persona IDs to participate (e.g., aoi,haru,gou)")
-		numChas       = flag.Int("num-chas", 3, "Number of random Chas to participate (used if -chas is not provided)")
-		renderersStr  = flag.String("renderers", "console", "Comma-separated list of renderers to use (console, markdown)")
-		rssURL        = flag.String("rss-url", "", "URL of the RSS feed to use as a topic")
-		rssLimit      = flag.Int("rss-limit", 1, "Maximum number of RSS items to fetch")
-		outputDir     = flag.String("output", "./pages/content/posts", "Directory to save markdown files")
-		dataDir       = flag.String("data", "./data", "Directory for dynamic data like relationships")
-		noSave        = flag.Bool("no-save", false, "If true, relationship data will not be saved to files")
-	)
+	// サブコマンド
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		runRender(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "hub" {
+		runHub(os.Args[2:])
+		return
+	}
+
 	flag.Parse()
 
+	// シグナルを受け取ったら、実行中のセッションを終わらせ、デーモンモードでも次のセッションを始めません。
+	rootCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(rootCtx, *traceFile, *traceOTLP)
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to flush traces: %v\n", err)
+		}
+	}()
+
+	if *metricsAddr != "" {
+		metricsServer := metrics.Serve(*metricsAddr)
+		defer metricsServer.Close()
+	}
+
+	// -every の間隔は、前のセッションの終了からではなく開始から数えます。
+	// セッションが間隔より長くかかった場合は、終わりしだい次のセッションを始めます。
+	var ticker *time.Ticker
+	if *every > 0 {
+		ticker = time.NewTicker(*every)
+		defer ticker.Stop()
+	}
+
+	failed := false
+	for {
+		metrics.SessionsStarted.Inc()
+		if err := runSession(rootCtx); err != nil {
+			metrics.SessionsFailed.Inc()
+			// セッションのログはバスに流れるため、ここでは標準エラー出力に書きます。
+			fmt.Fprintf(os.Stderr, "session failed: %v\n", err)
+			failed = true
+		} else {
+			metrics.SessionsFinished.Inc()
+		}
+
+		if ticker == nil {
+			break
+		}
+		select {
+		case <-rootCtx.Done():
+		case <-ticker.C:
+			continue
+		}
+		break
+	}
+
+	if failed && *every <= 0 {
+		os.Exit(1)
+	}
+}
+
+// runSession は、ひとつのセッションを実行します。rootCtx がキャンセルされると、セッションを終了します。
+func runSession(rootCtx context.Context) error {
+	startedAt := time.Now()
+
 	// --- 主要コンポーネントの初期化 (busが先) ---
-	bus := buspkg.NewMemoryBus()
+	policy, err := buspkg.ParsePolicy(*busPolicy)
+	if err != nil {
+		return fmt.Errorf("invalid -bus-policy: %w", err)
+	}
+	busOpts := []buspkg.Option{
+		buspkg.WithDefaultBufferSize(*busBuffer),
+		buspkg.WithDefaultPolicy(policy),
+		buspkg.WithDefaultBlockTimeout(*busTimeout),
+		buspkg.WithSessionID(session.NewID(startedAt)),
+		buspkg.WithDropHandler(func(subscriber string, m *message.Message) {
+			metrics.BusDropped.WithLabelValues(subscriber, string(m.Kind)).Inc()
+		}),
+	}
+	var bus buspkg.Bus
+	if *busAddr != "" {
+		bus, err = netbus.Dial(*busAddr, "kaigi-"+session.NewID(startedAt), busOpts...)
+		if err != nil {
+			return fmt.Errorf("failed to connect to bus hub: %w", err)
+		}
+	} else {
+		bus = buspkg.NewMemoryBus(busOpts...)
+	}
+
+	var hub *netbus.Hub
+	if *busListen != "" {
+		hub = netbus.NewHub(bus)
+		go func() {
+			if err := hub.ListenAndServe(*busListen); err != nil {
+				slog.Error("bus hub stopped", "error", err)
+			}
+		}()
+	}
+	// 途中でエラーになった場合も、バスとハブを閉じます。どちらも二度閉じても問題ありません。
+	defer func() {
+		bus.Close()
+		if hub != nil {
+			hub.Close()
+		}
+	}()
 
 	// ★★★ ここでslogのデフォルトハンドラをBusHandlerに設定 ★★★
-	busHandler := buslog.NewBusHandler(bus)
+	busHandler, closeLog, err := buildLogHandler(bus, *logLevel, *logFile, *logFormat)
+	if err != nil {
+		return fmt.Errorf("failed to set up logging: %w", err)
+	}
+	defer closeLog()
 	logger := slog.New(busHandler)
 	slog.SetDefault(logger)
 
-	// --- コンテキストとシグナルハンドリング ---
-	ctx, cancel := context.WithCancel(context.Background())
+	// --- コンテキスト ---
+	ctx, cancel := context.WithCancel(rootCtx)
 	defer cancel()
-	go func() {
-		sigCh := make(chan os.Signal, 1)
-		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-		<-sigCh
-		cancel()
-	}()
 
 	// --- 環境変数 ---
 	projectId := os.Getenv("GOOGLE_CLOUD_PROJECT_ID")
 	if projectId == "" {
-		log.Fatal("set GOOGLE_CLOUD_PROJECT_ID environment variable")
+		return fmt.Errorf("set GOOGLE_CLOUD_PROJECT_ID environment variable")
 	}
 	location := os.Getenv("LOCATION")
 	if location == "" {
-		log.Fatal("set LOCATION environment variable")
+		return fmt.Errorf("set LOCATION environment variable")
 	}
 
 	// --- 初期化処理 ---
 	topics, err := buildTopics(ctx, *rssURL, *rssLimit)
 	if err != nil {
-		log.Fatalf("failed to build topics: %v", err)
+		return fmt.Errorf("failed to build topics: %w", err)
 	}
 
-	turnManager := turn.NewMutexManager()
+	sess := session.New(startedAt, topics, collectFlags())
+
+	// セッション全体をひとつのトレースにまとめます。参加者には、このスパンを持つ ctx を渡します。
+	ctx, sessionSpan := tracer.Start(ctx, "session", trace.WithAttributes(
+		attribute.String("kaigi.session.id", sess.ID),
+		attribute.Int("kaigi.max_turns", *maxTurns),
+	))
+
+	// バスを別のプロセスと共有する場合は、ほかのプロセスの参加者ともターンを取り合うため、バスを通してターンを割り当てます。
+	// セッションの終了の判断と参加者の紹介は、ホストのプロセスだけが行います。
+	shared := *busAddr != "" || *busListen != ""
+	host := *busAddr == "" || *busHost
+	var turnManager turn.Manager
+	if shared {
+		turnManager = turn.NewBusManager(bus)
+	} else {
+		turnManager = turn.NewMutexManager()
+	}
 	var wg sync.WaitGroup
 
 	// 1. レンダラーを構築
-	activeRenderers := buildRenderers(*renderersStr, *outputDir, topics)
+	// 人間の参加者が標準入力から発言する場合は、TUI のキー操作には使いません。
+	opts, err := renderFlags.options(*maxTurns, *humanPath == "" || *humanSocket != "")
+	if err != nil {
+		return err
+	}
+	opts.WebAddr = *webAddr
+	if *voiceEmotion {
+		opts.Emotions = llm.NewGemini(ctx, projectId, location, "gemini-2.5-flash-lite")
+	}
+	if *editorial {
+		opts.Editor = llm.NewGemini(ctx, projectId, location, "gemini-2.5-flash-lite")
+	}
+	activeRenderers, err := renderer.Build(*renderersStr, opts)
+	if err != nil {
+		return err
+	}
+	// ジャーナルは、markdown レンダラーが書かせた記事のタイトルなども記録するため、最後に最終処理を行います。
+	if *journalDir != "" {
+		activeRenderers = append(activeRenderers, journal.NewWriter(*journalDir, opts.DramaticSwing))
+	}
+	if *metricsAddr != "" {
+		activeRenderers = append(activeRenderers, metrics.NewCollector())
+	}
 
 	// 2. レンダラーを起動
+	// レンダラーは会話の終了後も最終処理まで動き続けるため、会話の終了では取り消されないコンテキストを渡します。
+	// このコンテキストは、会話の終了後にもう一度シグナルを受け取ったときに取り消します (cancelOnSignal を参照)。
+	renderCtx, cancelRender := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelRender()
+	// 途中でエラーになった場合も、レンダラーがバスを読み終えるのを待ちます。コンソールの TUI は、そこで端末を元に戻します。
+	defer func() {
+		bus.Close()
+		wg.Wait()
+	}()
 	for _, r := range activeRenderers {
-		if err := r.Render(bus, &wg); err != nil {
-			log.Fatalf("failed to start renderer: %v", err)
+		if err := r.Render(renderCtx, sess, bus, &wg); err != nil {
+			return fmt.Errorf("failed to start renderer: %w", err)
 		}
 	}
 
-	sup := supervisor.NewSupervisor(*maxTurns, bus, cancel)
+	var sup *supervisor.Supervisor
+	if host {
+		sup = supervisor.NewSupervisor(*maxTurns, bus, cancel)
+	} else {
+		sup = supervisor.NewGuestSupervisor(*maxTurns, bus, cancel)
+	}
 	sup.Start()
 
-	// --- Chaの起動 ---
+	// --- 参加者の起動 ---
 	personaPool, err := persona.NewPool()
 	if err != nil {
-		log.Fatalf("failed to load persona pool: %v", err)
+		return fmt.Errorf("failed to load persona pool: %w", err)
 	}
 
 	personas, err := buildPersonas(personaPool, *personaIDsStr, *numChas)
 	if err != nil {
-		log.Fatalf("failed to build personas: %v", err)
+		return fmt.Errorf("failed to build personas: %w", err)
 	}
 
-	relationshipStore := persona.NewRelationshipStore(*dataDir)
-	for _, p := range personas {
-		if err := relationshipStore.LoadForPersona(p); err != nil {
-			slog.Error("failed to load relationship for persona", "personaId", p.PersonaId, "error", err)
+	var humanPersona *persona.Persona
+	if *humanPath != "" {
+		humanPersona, err = buildHumanPersona(personaPool, *humanPath)
+		if err != nil {
+			return fmt.Errorf("failed to build human persona: %w", err)
 		}
+		personas = append(personas, humanPersona)
 	}
-	slog.Info("Successfully loaded static personas and dynamic relationships.")
 
-	var chas []*cha.Cha
+	schedule, err := roster.ParseSchedule(*scheduleStr)
+	if err != nil {
+		return fmt.Errorf("failed to parse schedule: %w", err)
+	}
+
+	moderationReport := moderation.NewReport()
+	moderationFilter, err := buildModerationFilter(ctx, projectId, location, *modRulesPath, *modLLM, *modAction, *modRetries, moderationReport)
+	if err != nil {
+		return fmt.Errorf("failed to build moderation filter: %w", err)
+	}
+
+	relationshipStore := persona.NewRelationshipStore(*dataDir)
+	cast := roster.NewRoster(bus, relationshipStore, func(p *persona.Persona) roster.Participant {
+		llmClient := llm.NewGemini(ctx, projectId, location, "gemini-2.5-flash-lite")
+		return cha.NewCha(ctx, "cha-"+p.PersonaId, p, llmClient, bus, turnManager, sup, topics, moderationFilter)
+	})
+
 	var personaNames []string
 	for _, p := range personas {
-		llmClient := llm.NewGemini(ctx, projectId, location, "gemini-2.5-flash-lite")
-		chaInstance := cha.NewCha(ctx, "cha-"+p.PersonaId, p, llmClient, bus, turnManager, sup, topics)
-		chas = append(chas, chaInstance)
+		if p == humanPersona {
+			input, err := buildHumanInput(ctx, *humanSocket)
+			if err != nil {
+				return fmt.Errorf("failed to open human input: %w", err)
+			}
+			err = cast.JoinWith(p, human.NewHuman(ctx, p, input, bus, turnManager))
+		} else {
+			err = cast.Join(p)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to join persona %s: %w", p.PersonaId, err)
+		}
 		personaNames = append(personaNames, p.DisplayName)
-		chaInstance.Start()
-		slog.Info("Started Cha", "personaId", p.PersonaId, "displayName", p.DisplayName)
 	}
+	slog.Info("Successfully loaded static personas and dynamic relationships.")
+
+	roster.NewScheduler(cast, personaPool, bus, schedule).Start()
 
 	// --- 会話開始 ---
-	if err := bus.Broadcast(&message.Message{
-		Kind: message.KindSystem,
-		Text: fmt.Sprintf("参加者は %s の計 %d 名です。", strings.Join(personaNames, "、"), len(personas)),
-	}); err != nil {
-		panic(fmt.Errorf("failed to broadcast initial message: %w", err))
+	if host {
+		if err := bus.Broadcast(&message.Message{
+			Kind: message.KindSystem,
+			Text: fmt.Sprintf("参加者は %s の計 %d 名です。", strings.Join(personaNames, "、"), len(personas)),
+		}); err != nil {
+			return fmt.Errorf("failed to broadcast initial message: %w", err)
+		}
 	}
 
 	<-ctx.Done()
+	if rootCtx.Err() != nil && !host {
+		// ゲストがシグナルで抜ける場合は、会話を続けるほかのプロセスのために、このプロセスの参加者だけを退室させます。
+		cast.LeaveAll()
+	} else if rootCtx.Err() != nil {
+		// Supervisor ではなくシグナルで終了した場合は、ここで終了の理由を流します。
+		if err := bus.Broadcast(&message.Message{
+			Text: string(session.EndInterrupted),
+			At:   time.Now(),
+			Kind: message.KindEnd,
+		}); err != nil {
+			slog.Error("failed to broadcast end message", "error", err)
+		}
+	}
 
 	// --- 終了処理 ---
-	for _, c := range chas {
-		c.End()
-	}
+	// 最終処理の LLM の呼び出しなどは時間がかかるため、ここからのシグナルでは、それらを打ち切って終了処理を急ぎます。
+	stopSignal := cancelOnSignal(cancelRender)
+	defer stopSignal()
+
+	cast.EndAll()
+	logBusStats(bus)
 	bus.Close()
+	if hub != nil {
+		hub.Close()
+	}
 	wg.Wait()
 
+	// 途中参加したペルソナも含めて、最終処理と関係性の保存を行います。
+	personas = cast.Personas()
+
+	endReason := sup.EndReason()
+	if rootCtx.Err() != nil {
+		endReason = session.EndInterrupted
+	}
+	sess.End(time.Now(), endReason, personas, sup.Stats())
+
 	slog.Info("Finalizing renderers...")
-	for _, r := range activeRenderers {
-		if err := r.Finalize(personas); err != nil {
-			slog.Error("failed to finalize renderer", "error", err)
+	// 最終処理に失敗しても、関係性の保存は続け、失敗は最後に返します。
+	finalizeErr := finalizeRenderers(renderCtx, sess, activeRenderers)
+	if finalizeErr != nil {
+		slog.Error("failed to finalize renderers", "error", finalizeErr)
+	}
+
+	if moderationFilter != nil {
+		reportPath := filepath.Join(*modReportDir, sess.ID+".yaml")
+		if err := moderationReport.WriteFile(reportPath); err != nil {
+			slog.Error("failed to write moderation report", "error", err)
 		}
+		counts := moderationReport.Counts()
+		slog.Info("Moderation summary",
+			"regenerated", counts[moderation.ActionRegenerate],
+			"redacted", counts[moderation.ActionRedact],
+			"dropped", counts[moderation.ActionDrop],
+			"report", reportPath,
+		)
 	}
 
 	if !*noSave {
@@ -159,7 +435,110 @@ func main() {
 		slog.Info("Skipping relationship saving because -no-save flag is set.")
 	}
 
+	turns := sup.GetCurrentTurn()
+	metrics.SessionTurns.Observe(float64(turns))
+	sessionSpan.SetAttributes(attribute.Int("kaigi.turns", turns))
+	var sessionErr error
+	if endReason == session.EndError {
+		// LLM の呼び出しの失敗などで会話が途切れたセッションは、記事を書き出せても失敗として数えます。
+		sessionErr = fmt.Errorf("session ended with an error")
+	}
+	if finalizeErr != nil {
+		sessionErr = errors.Join(sessionErr, fmt.Errorf("failed to finalize renderers: %w", finalizeErr))
+	}
+	if sessionErr != nil {
+		sessionSpan.RecordError(sessionErr)
+		sessionSpan.SetStatus(codes.Error, sessionErr.Error())
+		sessionSpan.End()
+		return sessionErr
+	}
+	sessionSpan.End()
+
 	slog.Info("All components shut down gracefully.")
+	return nil
+}
+
+// cancelOnSignal は、SIGINT か SIGTERM を受け取ったら cancel を呼び出します。
+// 返される関数で、シグナルの待ち受けをやめます。
+func cancelOnSignal(cancel context.CancelFunc) func() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sigCh:
+			slog.Warn("Signal received during shutdown, cancelling renderer finalization.")
+			cancel()
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+	}
+}
+
+// buildLogHandler は、ログをバスに流し、logFile が指定されていればそこにも書き出すハンドラを生成します。
+// 返される関数で、ログファイルを閉じます。
+func buildLogHandler(bus buspkg.Bus, levelStr, logFile, format string) (slog.Handler, func(), error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(levelStr)); err != nil {
+		return nil, nil, fmt.Errorf("invalid -log-level: %w", err)
+	}
+	opts := []buslog.Option{buslog.WithLevel(level)}
+	closeLog := func() {}
+
+	if logFile != "" {
+		var w io.Writer = os.Stderr
+		if logFile != "-" {
+			f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to open log file: %w", err)
+			}
+			w = f
+			closeLog = func() { f.Close() }
+		}
+
+		handlerOpts := &slog.HandlerOptions{Level: level}
+		switch format {
+		case "text":
+			opts = append(opts, buslog.WithTee(slog.NewTextHandler(w, handlerOpts)))
+		case "json":
+			opts = append(opts, buslog.WithTee(slog.NewJSONHandler(w, handlerOpts)))
+		default:
+			closeLog()
+			return nil, nil, fmt.Errorf("unknown -log-format '%s'", format)
+		}
+	}
+
+	return buslog.NewBusHandler(bus, opts...), closeLog, nil
+}
+
+// collectFlags は、すべてのフラグの値をセッションのメタデータとして集めます。
+func collectFlags() map[string]string {
+	flags := make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+	return flags
+}
+
+// logBusStats は、メッセージを取りこぼした購読者がいればログに残します。
+func logBusStats(bus buspkg.Bus) {
+	reporter, ok := bus.(buspkg.StatsReporter)
+	if !ok {
+		return
+	}
+	for _, st := range reporter.Stats() {
+		if st.Dropped == 0 {
+			continue
+		}
+		attrs := []any{"subscriber", st.Name, "policy", st.Policy, "bufferSize", st.BufferSize, "delivered", st.Delivered, "dropped", st.Dropped}
+		for kind, n := range st.DroppedByKind {
+			attrs = append(attrs, "dropped."+string(kind), n)
+		}
+		slog.Warn("Bus subscriber dropped messages", attrs...)
+	}
 }
 
 func buildTopics(ctx context.Context, rssURL string, rssLimit int) ([]*topic.Topic, error) {
@@ -196,26 +575,127 @@ func buildPersonas(pool *persona.Pool, personaIDsStr string, numChas int) ([]*pe
 	return pool.GetRandomN(numChas)
 }
 
-func buildRenderers(renderersStr, outputDir string, topics []*topic.Topic) []renderer.Renderer {
-	var activeRenderers []renderer.Renderer
+func buildHumanPersona(pool *persona.Pool, path string) (*persona.Persona, error) {
+	p, err := persona.LoadFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pool.GetByPersonaId(p.PersonaId); err == nil {
+		return nil, fmt.Errorf("persona id '%s' is already used by an AI persona", p.PersonaId)
+	}
+	return p, nil
+}
+
+func buildHumanInput(ctx context.Context, socketPath string) (io.Reader, error) {
+	if socketPath == "" {
+		return os.Stdin, nil
+	}
+	return human.ListenUnix(ctx, socketPath)
+}
 
-	rendererNames := strings.Split(renderersStr, ",")
-	for _, rName := range rendererNames {
-		cleanRName := strings.TrimSpace(rName)
-		if cleanRName == "" {
-			continue
+func buildModerationFilter(
+	ctx context.Context,
+	projectId, location, rulesPath string,
+	useLLM bool,
+	action string,
+	retries int,
+	report *moderation.Report,
+) (*moderation.Filter, error) {
+	var checkers []moderation.Checker
+	if rulesPath != "" {
+		rules, err := moderation.LoadRules(rulesPath)
+		if err != nil {
+			return nil, err
+		}
+		engine, err := moderation.NewRuleEngine(rules)
+		if err != nil {
+			return nil, err
 		}
+		checkers = append(checkers, engine)
+	}
+	if useLLM {
+		checkers = append(checkers, moderation.NewLLMClassifier(llm.NewGemini(ctx, projectId, location, "gemini-2.5-flash-lite")))
+	}
+	if len(checkers) == 0 {
+		return nil, nil
+	}
 
-		slog.Info("Building renderer...", "name", cleanRName)
-		switch cleanRName {
-		case "console":
-			activeRenderers = append(activeRenderers, renderer.NewConsoleRenderer())
-		case "markdown":
-			activeRenderers = append(activeRenderers, renderer.NewMarkdownRenderer(outputDir, topics))
-		default:
-			slog.Warn("Unknown renderer specified, skipping.", "name", cleanRName)
-			continue
+	a, err := moderation.ParseAction(action)
+	if err != nil {
+		return nil, err
+	}
+	return moderation.NewFilter(moderation.Policy{Action: a, MaxRetries: retries}, report, checkers...), nil
+}
+
+// buildFrontMatterConfig は、フラグの値から Markdown の front matter の設定を組み立てます。
+func buildFrontMatterConfig(format, fieldsStr, categoriesStr string, draft bool) (renderer.FrontMatterConfig, error) {
+	cfg := renderer.FrontMatterConfig{
+		Format:     renderer.FrontMatterFormat(format),
+		Fields:     splitList(fieldsStr),
+		Categories: splitList(categoriesStr),
+		Draft:      draft,
+	}
+	if err := cfg.Validate(); err != nil {
+		return renderer.FrontMatterConfig{}, err
+	}
+	return cfg, nil
+}
+
+// buildSubtitleConfig は、フラグの値から字幕の設定を組み立てます。
+func buildSubtitleConfig(timing string, cps float64, lineWidth, maxLines int) (renderer.SubtitleConfig, error) {
+	t, err := renderer.ParseSubtitleTiming(timing)
+	if err != nil {
+		return renderer.SubtitleConfig{}, err
+	}
+	if cps <= 0 {
+		return renderer.SubtitleConfig{}, fmt.Errorf("subtitle cps must be positive, got %v", cps)
+	}
+	return renderer.SubtitleConfig{Timing: t, CharsPerSecond: cps, LineWidth: lineWidth, MaxLines: maxLines}, nil
+}
+
+// buildConsoleConfig は、コンソールへの表示の設定を確認して組み立てます。
+// keys が true で標準入力が端末の場合は、TUI のキー操作を標準入力から読み込みます。
+func buildConsoleConfig(mode string, typingDelay time.Duration, showLog bool, maxTurns int, keys bool) (renderer.ConsoleConfig, error) {
+	m, err := renderer.ParseConsoleMode(mode)
+	if err != nil {
+		return renderer.ConsoleConfig{}, err
+	}
+	if typingDelay < 0 {
+		return renderer.ConsoleConfig{}, fmt.Errorf("typing delay must not be negative, got %v", typingDelay)
+	}
+	cfg := renderer.ConsoleConfig{Mode: m, TypingDelay: typingDelay, ShowLog: showLog, MaxTurns: maxTurns}
+	if keys {
+		cfg.Keys = os.Stdin
+	}
+	return cfg, nil
+}
+
+// splitList は、カンマ区切りの値を、前後の空白を除いて分割します。空の要素は含めません。
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// finalizeRenderers は、すべてのレンダラーの最終処理を行い、失敗をまとめて返します。
+// ひとつのレンダラーが失敗しても、残りのレンダラーの最終処理は続けます。
+func finalizeRenderers(ctx context.Context, sess *session.Session, renderers []renderer.Renderer) error {
+	var errs []error
+	for _, r := range renderers {
+		spanCtx, span := tracer.Start(ctx, "renderer.Finalize", trace.WithAttributes(
+			attribute.String("kaigi.renderer", fmt.Sprintf("%T", r)),
+		))
+		if err := r.Finalize(spanCtx, sess); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			metrics.Errors.WithLabelValues(metrics.ErrorRenderer).Inc()
+			errs = append(errs, fmt.Errorf("%T: %w", r, err))
 		}
+		span.End()
 	}
-	return activeRenderers
+	return errors.Join(errs...)
 }
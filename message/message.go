@@ -1,6 +1,9 @@
 package message
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"time"
 
 	"github.com/sat8bit/kaigi/persona"
@@ -14,12 +17,43 @@ const (
 	KindError       Kind = "error"
 	KindEnd         Kind = "end"
 	KindTurnChanged Kind = "turn_changed"
-	KindLog         Kind = "log" // ★★★ ログメッセージ用のKindを追加 ★★★
+	KindLog         Kind = "log"   // ★★★ ログメッセージ用のKindを追加 ★★★
+	KindJoin        Kind = "join"  // From のペルソナが会話に参加した
+	KindLeave       Kind = "leave" // From のペルソナが会話から退室した
+	// KindTyping は、From のペルソナが発言を生成し始めたことを示します。
+	KindTyping Kind = "typing"
+	// KindRelationship は、From のペルソナの Relationship が更新されたことを示します。
+	KindRelationship Kind = "relationship"
+	// KindTurnRequest は、ターンの要求です。ID で要求を識別します (turn.BusManager を参照)。
+	KindTurnRequest Kind = "turn_request"
+	// KindTurnRelease は、ReplyTo の要求で得たターンの解放か、要求の取り下げです。
+	KindTurnRelease Kind = "turn_release"
 )
 
 type Message struct {
+	// ID は、メッセージを一意に識別する文字列です。空の場合はバスが割り当てます。
+	ID string
+	// Seq は、バスが割り当てる通し番号です。セッション内で単調に増加します。
+	Seq uint64
+	// SessionID は、メッセージが流れたセッションのIDです。空の場合はバスが割り当てます。
+	SessionID string
+	// ReplyTo は、このメッセージが応答している発言の ID です。応答先がなければ空です。
+	ReplyTo string
+
 	From *persona.Persona
 	Text string
 	At   time.Time
 	Kind Kind
+
+	// Relationship は、KindRelationship のときに、更新後の関係性を保持します。
+	Relationship *persona.Relationship
+}
+
+// NewID は、メッセージIDとして使うランダムな文字列を生成します。
+func NewID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Errorf("failed to generate message id: %w", err))
+	}
+	return hex.EncodeToString(b)
 }
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	buspkg "github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/session"
+)
+
+// Collector は、バスに流れたメッセージからメトリクスを集めます。
+// レンダラーと同じく Render で購読を始めます。
+type Collector struct{}
+
+// NewCollector は、新しい Collector を生成します。
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// Render は、バスの購読を開始します。
+func (c *Collector) Render(ctx context.Context, sess *session.Session, b buspkg.Bus, wg *sync.WaitGroup) error {
+	messageCh := b.Subscribe(
+		buspkg.WithName("metrics"),
+		buspkg.WithBufferSize(256),
+		buspkg.WithPolicy(buspkg.PolicyBlock),
+		buspkg.WithBlockTimeout(time.Second),
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for msg := range messageCh {
+			Messages.WithLabelValues(string(msg.Kind)).Inc()
+			switch msg.Kind {
+			case message.KindError:
+				Errors.WithLabelValues(ErrorSession).Inc()
+			case message.KindRelationship:
+				if msg.From != nil && msg.Relationship != nil {
+					Affinity.WithLabelValues(msg.From.PersonaId, msg.Relationship.TargetPersonaId).Set(float64(msg.Relationship.Affinity))
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Finalize は、何もしません。メトリクスはプロセスが終了するまで公開され続けます。
+func (c *Collector) Finalize(ctx context.Context, sess *session.Session) error {
+	return nil
+}
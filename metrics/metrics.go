@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry は、kaigi のすべてのメトリクスを登録するレジストリです。
+var Registry = prometheus.NewRegistry()
+
+var (
+	// SessionsStarted は、開始したセッションの数です。
+	SessionsStarted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kaigi_sessions_started_total",
+		Help: "Number of sessions started.",
+	})
+	// SessionsFinished は、最後まで終了処理を終えたセッションの数です。
+	SessionsFinished = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kaigi_sessions_finished_total",
+		Help: "Number of sessions that finished and were finalized.",
+	})
+	// SessionsFailed は、開始や終了処理に失敗したか、会話がエラーで途切れたセッションの数です。
+	SessionsFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kaigi_sessions_failed_total",
+		Help: "Number of sessions that failed to start, ended with an error or failed to finalize.",
+	})
+	// SessionTurns は、セッションごとのターン数の分布です。
+	SessionTurns = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kaigi_session_turns",
+		Help:    "Number of turns per finished session.",
+		Buckets: prometheus.LinearBuckets(5, 5, 10),
+	})
+	// LLMRequestDuration は、LLM の呼び出しにかかった時間です。
+	LLMRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kaigi_llm_request_duration_seconds",
+		Help:    "Latency of LLM calls.",
+		Buckets: prometheus.ExponentialBuckets(0.25, 2, 8),
+	}, []string{"operation", "model"})
+	// LLMTokens は、ペルソナごとに使ったトークンの数です。direction は input か output です。
+	LLMTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kaigi_llm_tokens_total",
+		Help: "Tokens used by LLM calls.",
+	}, []string{"persona", "operation", "direction"})
+	// Errors は、種類ごとのエラーの数です。
+	Errors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kaigi_errors_total",
+		Help: "Number of errors by kind.",
+	}, []string{"kind"})
+	// Messages は、バスに流れたメッセージの数です。
+	Messages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kaigi_bus_messages_total",
+		Help: "Number of messages broadcast on the bus by kind.",
+	}, []string{"kind"})
+	// BusDropped は、購読者が取りこぼしたメッセージの数です。
+	BusDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kaigi_bus_dropped_total",
+		Help: "Number of messages dropped by bus subscribers.",
+	}, []string{"subscriber", "kind"})
+	// Affinity は、あるペルソナから見た別のペルソナへの好感度の最新の値です。
+	Affinity = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kaigi_affinity",
+		Help: "Latest affinity of a persona towards another persona.",
+	}, []string{"persona", "target"})
+)
+
+// エラーの種類です。
+const (
+	ErrorLLM        = "llm"
+	ErrorSession    = "session"
+	ErrorRenderer   = "renderer"
+	ErrorModeration = "moderation"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		SessionsStarted,
+		SessionsFinished,
+		SessionsFailed,
+		SessionTurns,
+		LLMRequestDuration,
+		LLMTokens,
+		Errors,
+		Messages,
+		BusDropped,
+		Affinity,
+	)
+}
+
+// Serve は、addr で /metrics を公開する HTTP サーバーを起動します。
+// 返されたサーバーは、呼び出し側が Shutdown してください。
+func Serve(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics server stopped", "error", err)
+		}
+	}()
+	return server
+}
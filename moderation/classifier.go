@@ -0,0 +1,42 @@
+package moderation
+
+import (
+	"context"
+	"strings"
+
+	"github.com/sat8bit/kaigi/llm"
+	"github.com/sat8bit/kaigi/persona"
+)
+
+// LLMClassifier は、LLM に発言の安全性を判定させる Checker です。
+// 違反箇所を特定できないため、この違反は伏せ字にできません。
+type LLMClassifier struct {
+	moderator llm.Moderator
+}
+
+// NewLLMClassifier は新しい LLMClassifier を生成します。
+func NewLLMClassifier(moderator llm.Moderator) *LLMClassifier {
+	return &LLMClassifier{moderator: moderator}
+}
+
+// Check は、LLM に発言を判定させます。
+func (c *LLMClassifier) Check(ctx context.Context, speaker *persona.Persona, text string) ([]*Violation, error) {
+	result, err := c.moderator.Moderate(ctx, &llm.ModerateInput{
+		Speaker: speaker,
+		Text:    text,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !result.Flagged {
+		return nil, nil
+	}
+
+	rule := "llm"
+	if len(result.Categories) > 0 {
+		rule = "llm:" + strings.Join(result.Categories, "+")
+	}
+	return []*Violation{{Rule: rule, Reason: result.Reason}}, nil
+}
+
+var _ Checker = (*LLMClassifier)(nil)
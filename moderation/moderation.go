@@ -0,0 +1,158 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/sat8bit/kaigi/metrics"
+	"github.com/sat8bit/kaigi/persona"
+)
+
+// Action は、違反が見つかった発言の扱い方です。
+type Action string
+
+const (
+	// ActionRegenerate は、発言を作り直します。上限回数を超えた場合は破棄します。
+	ActionRegenerate Action = "regenerate"
+	// ActionRedact は、違反箇所を伏せ字にして発言します。伏せ字にできない違反の場合は破棄します。
+	ActionRedact Action = "redact"
+	// ActionDrop は、発言を破棄します。
+	ActionDrop Action = "drop"
+)
+
+// ParseAction は、文字列を Action に変換します。
+func ParseAction(s string) (Action, error) {
+	switch a := Action(s); a {
+	case ActionRegenerate, ActionRedact, ActionDrop:
+		return a, nil
+	}
+	return "", fmt.Errorf("unknown moderation action '%s'", s)
+}
+
+// Violation は、ひとつのルールへの違反を表します。
+type Violation struct {
+	// Rule は、違反したルールの名前です。
+	Rule string
+	// Reason は、違反の理由です。
+	Reason string
+
+	// redact は、違反箇所を伏せた文字列を返します。nil の場合、伏せ字にできません。
+	redact func(text string) string
+}
+
+// Checker は、発言内容を検査するコンポーネントが満たすインターフェースです。
+type Checker interface {
+	Check(ctx context.Context, speaker *persona.Persona, text string) ([]*Violation, error)
+}
+
+// Policy は、違反が見つかったときの振る舞いを定義します。
+type Policy struct {
+	Action Action
+	// MaxRetries は、ActionRegenerate のときに作り直す最大回数です。
+	MaxRetries int
+}
+
+// Filter は、生成された発言をブロードキャストする前に検査するモデレーション段です。
+type Filter struct {
+	checkers []Checker
+	policy   Policy
+	report   *Report
+}
+
+// NewFilter は新しい Filter を生成します。
+func NewFilter(policy Policy, report *Report, checkers ...Checker) *Filter {
+	return &Filter{
+		checkers: checkers,
+		policy:   policy,
+		report:   report,
+	}
+}
+
+// Apply は、text を検査し、ブロードキャストしてよい発言を返します。
+// 発言を破棄すべき場合は ok が false になります。
+// ActionRegenerate の場合、regenerate を使って発言を作り直します。
+func (f *Filter) Apply(
+	ctx context.Context,
+	speaker *persona.Persona,
+	text string,
+	regenerate func() (string, error),
+) (result string, ok bool, err error) {
+	for attempt := 0; ; attempt++ {
+		violations, err := f.check(ctx, speaker, text)
+		if err != nil {
+			return "", false, err
+		}
+		if len(violations) == 0 {
+			return text, true, nil
+		}
+
+		switch f.policy.Action {
+		case ActionRegenerate:
+			if attempt < f.policy.MaxRetries {
+				f.record(speaker, text, "", ActionRegenerate, violations)
+				if text, err = regenerate(); err != nil {
+					return "", false, err
+				}
+				continue
+			}
+		case ActionRedact:
+			if redacted, ok := redactAll(text, violations); ok {
+				f.record(speaker, text, redacted, ActionRedact, violations)
+				return redacted, true, nil
+			}
+		}
+
+		f.record(speaker, text, "", ActionDrop, violations)
+		return "", false, nil
+	}
+}
+
+// check は、すべての Checker で text を検査します。
+// LLM の呼び出しの失敗などで検査できなかった Checker は、記録したうえで読み飛ばします (フェイルオープン)。
+// 一時的な失敗でセッション全体を終わらせないためです。ctx が終了した場合だけはエラーを返します。
+func (f *Filter) check(ctx context.Context, speaker *persona.Persona, text string) ([]*Violation, error) {
+	var violations []*Violation
+	for _, c := range f.checkers {
+		v, err := c.Check(ctx, speaker, text)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("moderation check failed: %w", err)
+			}
+			metrics.Errors.WithLabelValues(metrics.ErrorModeration).Inc()
+			slog.Warn("Moderation check failed, skipping it for this utterance", "personaId", speaker.PersonaId, "checker", fmt.Sprintf("%T", c), "error", err)
+			continue
+		}
+		violations = append(violations, v...)
+	}
+	return violations, nil
+}
+
+func (f *Filter) record(speaker *persona.Persona, original, result string, action Action, violations []*Violation) {
+	event := &Event{
+		At:        time.Now(),
+		PersonaId: speaker.PersonaId,
+		Action:    action,
+		Original:  original,
+		Result:    result,
+	}
+	for _, v := range violations {
+		event.Rules = append(event.Rules, v.Rule)
+		event.Reasons = append(event.Reasons, v.Reason)
+	}
+	f.report.Add(event)
+
+	slog.Warn("Moderation rule violated", "personaId", speaker.PersonaId, "action", action, "rules", strings.Join(event.Rules, ","))
+}
+
+func redactAll(text string, violations []*Violation) (string, bool) {
+	for _, v := range violations {
+		if v.redact == nil {
+			return "", false
+		}
+		text = v.redact(text)
+	}
+	return text, true
+}
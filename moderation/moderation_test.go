@@ -0,0 +1,40 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sat8bit/kaigi/persona"
+)
+
+// failingChecker は、常に失敗する Checker です。LLM の呼び出しの失敗に相当します。
+type failingChecker struct{}
+
+func (failingChecker) Check(ctx context.Context, speaker *persona.Persona, text string) ([]*Violation, error) {
+	return nil, errors.New("classifier unavailable")
+}
+
+// TestFilterFailsOpen は、検査に失敗した Checker があっても、ほかの Checker の結果で発言を扱うことを確かめます。
+func TestFilterFailsOpen(t *testing.T) {
+	rules, err := NewRuleEngine(&Rules{BlockedWords: []string{"禁止"}})
+	if err != nil {
+		t.Fatalf("new rule engine: %v", err)
+	}
+	f := NewFilter(Policy{Action: ActionDrop}, NewReport(), failingChecker{}, rules)
+	speaker := &persona.Persona{PersonaId: "aoi"}
+
+	text, ok, err := f.Apply(context.Background(), speaker, "こんにちは", nil)
+	if err != nil || !ok || text != "こんにちは" {
+		t.Errorf("got (%q, %v, %v), want the utterance published", text, ok, err)
+	}
+	if _, ok, err := f.Apply(context.Background(), speaker, "それは禁止です", nil); err != nil || ok {
+		t.Errorf("got (%v, %v), want the utterance dropped by the rules", ok, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := f.Apply(ctx, speaker, "こんにちは", nil); err == nil {
+		t.Error("Apply succeeded after the context was cancelled")
+	}
+}
@@ -0,0 +1,83 @@
+package moderation
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Event は、モデレーションによってひとつの発言に対して行われた処置の記録です。
+type Event struct {
+	At        time.Time `yaml:"at"`
+	PersonaId string    `yaml:"personaId"`
+	Action    Action    `yaml:"action"`
+	Rules     []string  `yaml:"rules"`
+	Reasons   []string  `yaml:"reasons"`
+	// Original は、処置前の発言です。公開されないよう、レポートにのみ残します。
+	Original string `yaml:"original"`
+	// Result は、伏せ字にした後の発言です。ActionRedact の場合のみ設定されます。
+	Result string `yaml:"result,omitempty"`
+}
+
+// Report は、セッション中のモデレーションの記録を集めます。
+type Report struct {
+	mu     sync.Mutex
+	events []*Event
+}
+
+// NewReport は新しい Report を生成します。
+func NewReport() *Report {
+	return &Report{}
+}
+
+// Add は、記録を追加します。
+func (r *Report) Add(e *Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+// Events は、これまでの記録を返します。
+func (r *Report) Events() []*Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := make([]*Event, len(r.events))
+	copy(events, r.events)
+	return events
+}
+
+// Counts は、処置の種類ごとの件数を返します。
+func (r *Report) Counts() map[Action]int {
+	counts := make(map[Action]int)
+	for _, e := range r.Events() {
+		counts[e.Action]++
+	}
+	return counts
+}
+
+// WriteFile は、記録をYAMLファイルとして書き出します。記録がなければ何もしません。
+func (r *Report) WriteFile(path string) error {
+	events := r.Events()
+	if len(events) == 0 {
+		return nil
+	}
+
+	data, err := yaml.Marshal(struct {
+		Events []*Event `yaml:"events"`
+	}{Events: events})
+	if err != nil {
+		return fmt.Errorf("failed to marshal moderation report: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create moderation report directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write moderation report %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/sat8bit/kaigi/persona"
+	"gopkg.in/yaml.v3"
+)
+
+const redactedText = "＊＊＊"
+
+// piiPatterns は、名前で有効にできる組み込みの個人情報パターンです。
+// 電話番号は、金額などの長い数字の一部に一致しないよう、区切りのある形か、区切りのない 10〜11 桁の番号だけを対象にし、
+// 前後が数字や英字でないことを求めます。
+var piiPatterns = map[string]*regexp.Regexp{
+	"email":      regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	"phone":      regexp.MustCompile(`\b(?:0\d{1,4}-\d{1,4}-\d{3,4}|0\d{9,10})\b`),
+	"postalCode": regexp.MustCompile(`〒?\d{3}-\d{4}`),
+	"creditCard": regexp.MustCompile(`\b(?:\d{4}[ -]?){3}\d{4}\b`),
+}
+
+// Rules は、ローカルのルールエンジンの設定です。YAMLファイルから読み込みます。
+type Rules struct {
+	// MaxLength は、発言の最大文字数（rune 数）です。0 の場合は制限しません。
+	MaxLength int `yaml:"maxLength"`
+	// BlockedWords は、発言に含まれてはいけない語句です。空の語句はすべての発言に一致するため、エラーになります。
+	BlockedWords []string `yaml:"blockedWords"`
+	// PersonalNames は、発言に含まれてはいけない実在の人物名です。空の名前はエラーになります。
+	PersonalNames []string `yaml:"personalNames"`
+	// PII は、有効にする組み込みの個人情報パターンの名前です（email, phone, postalCode, creditCard）。
+	PII []string `yaml:"pii"`
+	// Patterns は、任意の正規表現によるルールです。
+	Patterns []*PatternRule `yaml:"patterns"`
+}
+
+// PatternRule は、正規表現によるひとつのルールです。
+type PatternRule struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+}
+
+// LoadRules は、YAMLファイルからルールを読み込みます。
+func LoadRules(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read moderation rules %s: %w", path, err)
+	}
+	var rules Rules
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal moderation rules %s: %w", path, err)
+	}
+	return &rules, nil
+}
+
+type namedPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// RuleEngine は、Rules に基づいて発言を検査する Checker です。
+type RuleEngine struct {
+	maxLength int
+	patterns  []namedPattern
+}
+
+// NewRuleEngine は、ルールをコンパイルして新しい RuleEngine を生成します。
+func NewRuleEngine(rules *Rules) (*RuleEngine, error) {
+	e := &RuleEngine{maxLength: rules.MaxLength}
+
+	for _, w := range rules.BlockedWords {
+		if strings.TrimSpace(w) == "" {
+			return nil, fmt.Errorf("blocked word must not be empty")
+		}
+		e.patterns = append(e.patterns, namedPattern{name: "blockedWord", re: regexp.MustCompile(regexp.QuoteMeta(w))})
+	}
+	for _, n := range rules.PersonalNames {
+		if strings.TrimSpace(n) == "" {
+			return nil, fmt.Errorf("personal name must not be empty")
+		}
+		e.patterns = append(e.patterns, namedPattern{name: "personalName", re: regexp.MustCompile(regexp.QuoteMeta(n))})
+	}
+	for _, name := range rules.PII {
+		re, ok := piiPatterns[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown pii pattern '%s'", name)
+		}
+		e.patterns = append(e.patterns, namedPattern{name: "pii:" + name, re: re})
+	}
+	for _, p := range rules.Patterns {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile moderation pattern '%s': %w", p.Name, err)
+		}
+		e.patterns = append(e.patterns, namedPattern{name: p.Name, re: re})
+	}
+
+	return e, nil
+}
+
+// Check は、発言がルールに違反していないかを検査します。
+func (e *RuleEngine) Check(ctx context.Context, speaker *persona.Persona, text string) ([]*Violation, error) {
+	var violations []*Violation
+
+	for _, p := range e.patterns {
+		matches := p.re.FindAllString(text, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		re := p.re
+		violations = append(violations, &Violation{
+			Rule:   p.name,
+			Reason: fmt.Sprintf("matched %s", strings.Join(matches, ", ")),
+			redact: func(text string) string {
+				return re.ReplaceAllString(text, redactedText)
+			},
+		})
+	}
+
+	if e.maxLength > 0 {
+		if n := len([]rune(text)); n > e.maxLength {
+			maxLength := e.maxLength
+			violations = append(violations, &Violation{
+				Rule:   "maxLength",
+				Reason: fmt.Sprintf("%d characters exceeds the limit of %d", n, maxLength),
+				redact: func(text string) string {
+					runes := []rune(text)
+					if len(runes) <= maxLength {
+						return text
+					}
+					return string(runes[:maxLength-1]) + "…"
+				},
+			})
+		}
+	}
+
+	return violations, nil
+}
+
+var _ Checker = (*RuleEngine)(nil)
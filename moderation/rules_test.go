@@ -0,0 +1,81 @@
+package moderation
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPhonePattern(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{text: "電話は03-1234-5678です", want: true},
+		{text: "携帯は090-1234-5678まで", want: true},
+		{text: "09012345678に連絡して", want: true},
+		{text: "賞金は1000000円です", want: false},
+		{text: "10000000円の予算", want: false},
+		{text: "2024年の売上は0123456", want: false},
+		{text: "ID abc09012345678", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := piiPatterns["phone"].MatchString(tt.text); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRuleEngineRejectsEmptyWords(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules *Rules
+	}{
+		{name: "empty blocked word", rules: &Rules{BlockedWords: []string{"禁止", ""}}},
+		{name: "blank blocked word", rules: &Rules{BlockedWords: []string{" "}}},
+		{name: "empty personal name", rules: &Rules{PersonalNames: []string{""}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRuleEngine(tt.rules); err == nil {
+				t.Error("NewRuleEngine accepted an empty word")
+			}
+		})
+	}
+}
+
+func TestRuleEngineCheck(t *testing.T) {
+	e, err := NewRuleEngine(&Rules{BlockedWords: []string{"禁止"}, PII: []string{"phone"}})
+	if err != nil {
+		t.Fatalf("new rule engine: %v", err)
+	}
+	tests := []struct {
+		text      string
+		wantRules []string
+	}{
+		{text: "今日はいい天気ですね", wantRules: nil},
+		{text: "それは禁止です", wantRules: []string{"blockedWord"}},
+		{text: "03-1234-5678 は禁止", wantRules: []string{"blockedWord", "pii:phone"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			violations, err := e.Check(context.Background(), nil, tt.text)
+			if err != nil {
+				t.Fatalf("check: %v", err)
+			}
+			var got []string
+			for _, v := range violations {
+				got = append(got, v.Rule)
+			}
+			if len(got) != len(tt.wantRules) {
+				t.Fatalf("got rules %v, want %v", got, tt.wantRules)
+			}
+			for i := range got {
+				if got[i] != tt.wantRules[i] {
+					t.Errorf("got rules %v, want %v", got, tt.wantRules)
+				}
+			}
+		})
+	}
+}
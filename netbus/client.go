@@ -0,0 +1,325 @@
+package netbus
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	buspkg "github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/journal"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/persona"
+)
+
+const (
+	dialTimeout       = 5 * time.Second
+	maxReconnectDelay = 5 * time.Second
+	// closeFlushTimeout は、Close のときに送信済みのメッセージがハブに届くのを待つ時間です。
+	closeFlushTimeout = 2 * time.Second
+	// sendQueueSize は、ハブに書き出しきれていないメッセージの上限です。
+	// これを超えたら接続を張り直し、再接続したときに送り直します。
+	sendQueueSize = 1024
+)
+
+// Client は、ハブに接続する bus.Bus の実装です。
+// Broadcast したメッセージはハブに送られ、ハブから届いたメッセージ（自分が送ったものも含む）を
+// 内部の MemoryBus で購読者に配送します。接続が切れた場合は再接続し、受信済みの Seq の続きから
+// 受け取り直すとともに、ハブに届いたことを確認できていないメッセージを送り直します。
+type Client struct {
+	addr  string
+	name  string
+	local buspkg.Bus
+
+	mu   sync.Mutex
+	conn net.Conn
+	// queue は、接続中に書き出すメッセージです。ソケットへの書き込みは writeLoop が行い、
+	// ハブが詰まっても Broadcast を呼び出した側が止まらないようにします。切断中は nil です。
+	queue    chan *message.Message
+	personas map[string]*persona.Persona
+	// lastSeq は、受信したメッセージの最大の Seq です。
+	lastSeq uint64
+	// epoch は、lastSeq を数えたハブの Epoch です (Hello を参照)。
+	epoch string
+	// pending は、送信したがハブから戻ってきていないメッセージです。再接続時に送り直します。
+	pending []*message.Message
+	// flushed は、pending が空になったときに通知されます。
+	flushed chan struct{}
+	closed  bool
+	done    chan struct{}
+}
+
+// Dial は、addr のハブに接続する Client を生成します。name は、ハブのログでクライアントを識別するための名前です。
+// 最初の接続に失敗した場合はエラーを返します。opts は、ローカルの配送に使う MemoryBus に渡されます。
+func Dial(addr, name string, opts ...buspkg.Option) (buspkg.Bus, error) {
+	c := &Client{
+		addr:     addr,
+		name:     name,
+		local:    buspkg.NewMemoryBus(opts...),
+		personas: make(map[string]*persona.Persona),
+		flushed:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+
+	conn, err := c.connect()
+	if err != nil {
+		c.local.Close()
+		return nil, err
+	}
+	go c.run(conn)
+	return c, nil
+}
+
+// Broadcast は、メッセージをハブに送ります。
+// 接続が切れている間は、再接続したときにまとめて送ります。ただし KindLog は捨てます。
+// Seq と SessionID はハブで割り当てられます。ID は、再送時の重複を防ぐためにここで割り当てます。
+func (c *Client) Broadcast(m *message.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return fmt.Errorf("bus is closed")
+	}
+	if m.ID == "" {
+		m.ID = message.NewID()
+	}
+	if m.From != nil {
+		c.personas[m.From.PersonaId] = m.From
+	}
+
+	if c.queue == nil {
+		if m.Kind != message.KindLog {
+			c.pending = append(c.pending, m)
+		}
+		return nil
+	}
+
+	c.pending = append(c.pending, m)
+	select {
+	case c.queue <- m:
+	default:
+		// ハブへの書き出しが追いついていません。接続を切れば受信側が張り直し、その際に pending から送り直します。
+		c.conn.Close()
+	}
+	return nil
+}
+
+// Subscribe は、ハブから届くメッセージの購読を開始します。
+func (c *Client) Subscribe(opts ...buspkg.SubscribeOption) <-chan *message.Message {
+	return c.local.Subscribe(opts...)
+}
+
+// Close は、送信済みのメッセージがハブに届くのを少し待ってから、接続とすべての購読者チャネルを閉じます。
+func (c *Client) Close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	waiting := len(c.pending) > 0
+	c.mu.Unlock()
+
+	if waiting {
+		select {
+		case <-c.flushed:
+		case <-time.After(closeFlushTimeout):
+		}
+	}
+
+	close(c.done)
+	c.mu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.mu.Unlock()
+	c.local.Close()
+}
+
+// Stats は、ローカルの購読者ごとの配送状況を返します。
+func (c *Client) Stats() []buspkg.SubscriberStats {
+	if reporter, ok := c.local.(buspkg.StatsReporter); ok {
+		return reporter.Stats()
+	}
+	return nil
+}
+
+// connect は、ハブに接続して hello を送り、未確認のメッセージを送り直す writeLoop を起動します。
+func (c *Client) connect() (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", c.addr, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to bus hub %s: %w", c.addr, err)
+	}
+
+	c.mu.Lock()
+	hello := &Hello{Name: c.name, Since: c.lastSeq, Epoch: c.epoch}
+	c.mu.Unlock()
+
+	w := newFrameWriter(conn)
+	if err := w.write(&Frame{Type: FrameHello, Hello: hello}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send hello to bus hub %s: %w", c.addr, err)
+	}
+
+	// 未確認のメッセージを控えるのと queue を設定するのを同じロックの中で行い、送り直しと新しいメッセージの順番を保ちます。
+	c.mu.Lock()
+	backlog := append([]*message.Message(nil), c.pending...)
+	queue := make(chan *message.Message, sendQueueSize)
+	c.conn = conn
+	c.queue = queue
+	c.mu.Unlock()
+
+	go writeLoop(conn, w, backlog, queue)
+	return conn, nil
+}
+
+// writeLoop は、未確認のメッセージを送り直した後、queue に積まれたメッセージを順にハブに書き出します。
+// 書き出しに失敗したら接続を閉じ、queue が閉じられるまで残りを読み捨てます。
+func writeLoop(conn net.Conn, w *frameWriter, backlog []*message.Message, queue <-chan *message.Message) {
+	failed := false
+	write := func(m *message.Message) {
+		if failed {
+			return
+		}
+		if err := w.writeMessage(m); err != nil {
+			// 接続は受信側で切断を検知して張り直し、その際に送り直します。
+			conn.Close()
+			failed = true
+		}
+	}
+	for _, m := range backlog {
+		write(m)
+	}
+	for m := range queue {
+		write(m)
+	}
+}
+
+// run は、ハブからのメッセージを受信し続け、接続が切れたら張り直します。
+func (c *Client) run(conn net.Conn) {
+	for {
+		c.receive(conn)
+
+		c.mu.Lock()
+		queue := c.queue
+		c.conn = nil
+		c.queue = nil
+		c.mu.Unlock()
+		close(queue)
+
+		var err error
+		conn, err = c.reconnect()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// reconnect は、Close されるまで間隔を空けながら再接続を試みます。
+func (c *Client) reconnect() (net.Conn, error) {
+	delay := 100 * time.Millisecond
+	for {
+		select {
+		case <-c.done:
+			return nil, fmt.Errorf("bus is closed")
+		case <-time.After(delay):
+		}
+
+		conn, err := c.connect()
+		if err == nil {
+			return conn, nil
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// receive は、接続が切れるまでハブからのフレームを読み、ローカルの購読者に配送します。
+func (c *Client) receive(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var f Frame
+		if err := json.Unmarshal(scanner.Bytes(), &f); err != nil {
+			return
+		}
+		switch f.Type {
+		case FrameHello:
+			if f.Hello != nil {
+				c.setEpoch(f.Hello.Epoch)
+			}
+		case FramePersona:
+			if f.Persona == nil {
+				continue
+			}
+			c.mu.Lock()
+			// 自分が送ったペルソナは、ローカルのものをそのまま使います。
+			if _, ok := c.personas[f.Persona.PersonaId]; !ok {
+				c.personas[f.Persona.PersonaId] = f.Persona.ToPersona()
+			}
+			c.mu.Unlock()
+		case FrameMessage:
+			if f.Message == nil {
+				continue
+			}
+			if m := c.accept(f.Message); m != nil {
+				c.local.Broadcast(m)
+			}
+		}
+	}
+}
+
+// setEpoch は、接続したハブの Epoch を控えます。
+// ハブが起動し直していれば Seq は 1 から振り直されるため、受信済みの Seq を数え直します。
+func (c *Client) setEpoch(epoch string) {
+	c.mu.Lock()
+	restarted := c.epoch != "" && c.epoch != epoch
+	c.epoch = epoch
+	if restarted {
+		c.lastSeq = 0
+	}
+	c.mu.Unlock()
+
+	// ログはこのクライアントを通して流れるため、ロックを外してから書きます。
+	if restarted {
+		slog.Warn("Bus hub was restarted, receiving its history from the beginning", "addr", c.addr)
+	}
+}
+
+// accept は、受信したメッセージを復元します。既に受信済みのメッセージであれば nil を返します。
+func (c *Client) accept(r *journal.MessageRecord) *message.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if r.Seq <= c.lastSeq {
+		return nil
+	}
+	c.lastSeq = r.Seq
+
+	for i, m := range c.pending {
+		if m.ID == r.ID {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			break
+		}
+	}
+	if len(c.pending) == 0 && c.closed {
+		select {
+		case c.flushed <- struct{}{}:
+		default:
+		}
+	}
+
+	var from *persona.Persona
+	if r.From != "" {
+		from = c.personas[r.From]
+	}
+	return r.ToMessage(from)
+}
+
+// コンパイル時に Bus インターフェースを実装していることを保証します。
+var _ buspkg.Bus = (*Client)(nil)
+var _ buspkg.StatsReporter = (*Client)(nil)
@@ -0,0 +1,140 @@
+package netbus
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	buspkg "github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/persona"
+)
+
+// TestClientRoundTrip は、クライアントが送ったメッセージが、ハブで通し番号を振られて戻ってくることを確かめます。
+func TestClientRoundTrip(t *testing.T) {
+	b := buspkg.NewMemoryBus()
+	h, addr := startHub(t, b)
+	defer h.Close()
+	defer b.Close()
+
+	c, err := Dial(addr, "test")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+	ch := c.Subscribe(buspkg.WithKinds(message.KindCha), buspkg.WithBufferSize(16))
+
+	aoi := &persona.Persona{PersonaId: "aoi", DisplayName: "あおい"}
+	for _, text := range []string{"こんにちは", "いい天気ですね"} {
+		if err := c.Broadcast(&message.Message{Kind: message.KindCha, From: aoi, Text: text}); err != nil {
+			t.Fatalf("broadcast: %v", err)
+		}
+	}
+
+	var lastSeq uint64
+	for _, want := range []string{"こんにちは", "いい天気ですね"} {
+		select {
+		case m := <-ch:
+			if m.Text != want {
+				t.Errorf("got %q, want %q", m.Text, want)
+			}
+			if m.From == nil || m.From.PersonaId != "aoi" {
+				t.Errorf("got sender %v, want aoi", m.From)
+			}
+			if m.Seq <= lastSeq {
+				t.Errorf("got seq %d after %d", m.Seq, lastSeq)
+			}
+			lastSeq = m.Seq
+		case <-time.After(5 * time.Second):
+			t.Fatalf("did not receive %q", want)
+		}
+	}
+}
+
+// TestClientBroadcastDoesNotBlockOnStalledHub は、受信しないハブにつながっていても、Broadcast がすぐに戻ることを確かめます。
+func TestClientBroadcastDoesNotBlockOnStalledHub(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	// 接続を受け付けるだけで、何も読まないハブです。
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c, err := Dial(l.Addr().String(), "test")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		text := strings.Repeat("あ", 64*1024)
+		for i := 0; i < 200; i++ {
+			c.Broadcast(&message.Message{Kind: message.KindSystem, Text: text})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Broadcast blocked on a hub that does not read")
+	}
+}
+
+// TestClientReceivesAfterHubRestart は、ハブが起動し直して Seq を 1 から振り直しても、
+// 再接続したクライアントがその後のメッセージを受け取ることを確かめます。
+func TestClientReceivesAfterHubRestart(t *testing.T) {
+	b1 := buspkg.NewMemoryBus()
+	h1, addr := startHub(t, b1)
+
+	c, err := Dial(addr, "test")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+	ch := c.Subscribe(buspkg.WithKinds(message.KindSystem), buspkg.WithBufferSize(16))
+
+	receive := func(want string) {
+		t.Helper()
+		select {
+		case m := <-ch:
+			if m.Text != want {
+				t.Errorf("got %q, want %q", m.Text, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("did not receive %q", want)
+		}
+	}
+
+	waitForConns(t, h1, 1)
+	for _, text := range []string{"1", "2", "3"} {
+		b1.Broadcast(&message.Message{Kind: message.KindSystem, Text: text})
+		receive(text)
+	}
+	b1.Close()
+	h1.Close()
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("listen again: %v", err)
+	}
+	b2 := buspkg.NewMemoryBus()
+	h2 := NewHub(b2)
+	go h2.Serve(l)
+	defer h2.Close()
+	defer b2.Close()
+
+	waitForConns(t, h2, 1)
+	b2.Broadcast(&message.Message{Kind: message.KindSystem, Text: "after restart"})
+	receive("after restart")
+}
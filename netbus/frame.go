@@ -0,0 +1,38 @@
+package netbus
+
+import (
+	"github.com/sat8bit/kaigi/journal"
+)
+
+// FrameType は、ハブとクライアントの間で送受信する1行の種類です。
+type FrameType string
+
+const (
+	// FrameHello は、接続直後にクライアントが送る最初のフレームです。
+	// ハブも、履歴を送る前に自分の Epoch を入れて送り返します。
+	FrameHello FrameType = "hello"
+	// FramePersona は、ペルソナの静的な定義です。そのペルソナを参照するメッセージより前に送られます。
+	FramePersona FrameType = "persona"
+	// FrameMessage は、ひとつのメッセージです。
+	FrameMessage FrameType = "message"
+)
+
+// Frame は、ハブとクライアントの間で送受信する JSON の1行です。Type に対応するフィールドだけが設定されます。
+// ペルソナとメッセージの形式はジャーナルと同じで、メッセージの送信者は PersonaId で参照します。
+type Frame struct {
+	Type    FrameType              `json:"type"`
+	Hello   *Hello                 `json:"hello,omitempty"`
+	Persona *journal.PersonaRecord `json:"persona,omitempty"`
+	Message *journal.MessageRecord `json:"message,omitempty"`
+}
+
+// Hello は、クライアントの名前と、再接続時にどこから受信を再開するかを伝えます。
+type Hello struct {
+	Name string `json:"name"`
+	// Since は、クライアントが既に受信したメッセージの最大の Seq です。ハブはこれより後のメッセージから送ります。
+	Since uint64 `json:"since"`
+	// Epoch は、ハブを起動するたびに変わる識別子です。クライアントは Since を数えたハブの Epoch を送り、
+	// ハブは自分の Epoch を送り返します。ハブが起動し直して Seq を 1 から振り直した場合は、
+	// 互いの Epoch が食い違うため、ハブは履歴を初めから送り、クライアントは受信済みの Seq を数え直します。
+	Epoch string `json:"epoch,omitempty"`
+}
@@ -0,0 +1,373 @@
+package netbus
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	buspkg "github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/journal"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/persona"
+)
+
+// connBufferSize は、ひとつの接続に送りきれていないメッセージの上限です。
+// これを超えた接続は切断し、クライアントの再接続時に履歴から送り直します。
+const connBufferSize = 1024
+
+// writeTimeout は、ひとつのフレームを書き出すのを待つ時間の上限です。
+// これを超えた接続は、相手が読んでいないものとして切断します。テストで短くするため変数にしています。
+var writeTimeout = 10 * time.Second
+
+// historySize は、再接続したクライアントに送り直すために残しておくメッセージの数です。
+// これより古いメッセージを求めたクライアントには、残っている分だけを送ります。
+const historySize = 10000
+
+// Hub は、バスを TCP で公開し、別のプロセスのクライアントと中継します。
+// クライアントから届いたメッセージはバスにブロードキャストし、バスに流れたすべてのメッセージを
+// Seq の順で各クライアントに送ります。通し番号の割り当てはバスが行うため、すべての
+// クライアントが同じ順番でメッセージを受け取ります。
+type Hub struct {
+	bus buspkg.Bus
+	// epoch は、このハブの Epoch です (Hello を参照)。
+	epoch string
+
+	mu       sync.Mutex
+	listener net.Listener
+	personas map[string]*persona.Persona
+	// history は、再接続したクライアントに送り直すための、直近の historySize 件のメッセージです。
+	history []*message.Message
+	// seen は、受け付けたメッセージの ID です。再接続したクライアントが送り直したメッセージを重複させないために使います。
+	// history から落ちたメッセージの ID は、あわせて取り除きます。
+	seen  map[string]bool
+	conns map[*hubConn]struct{}
+	done  bool
+
+	// recorded は、バスが閉じられ、すべてのメッセージを接続に積み終えたときに閉じられます。
+	recorded chan struct{}
+	writers  sync.WaitGroup
+}
+
+// hubConn は、ハブに接続しているひとつのクライアントです。
+type hubConn struct {
+	conn net.Conn
+	name string
+	out  chan *message.Message
+	// gone は、クライアントが切断したか、out が一杯になって接続を切るときに閉じられます。
+	// 書き出しは、out に残っているメッセージを捨てて止めます。
+	// 書き込みの途中で止まっている場合に備え、あわせて conn も閉じます。
+	gone chan struct{}
+}
+
+// NewHub は、b を公開する Hub を生成します。b には通し番号を割り当てるバス (MemoryBus) を渡します。
+func NewHub(b buspkg.Bus) *Hub {
+	h := &Hub{
+		bus:      b,
+		epoch:    message.NewID(),
+		personas: make(map[string]*persona.Persona),
+		seen:     make(map[string]bool),
+		conns:    make(map[*hubConn]struct{}),
+		recorded: make(chan struct{}),
+	}
+
+	// ログも含めてすべてクライアントに届けたいので、ジャーナルと同じく大きめのバッファで待つようにします。
+	messageCh := b.Subscribe(
+		buspkg.WithName("netbus-hub"),
+		buspkg.WithBufferSize(1024),
+		buspkg.WithPolicy(buspkg.PolicyBlock),
+		buspkg.WithBlockTimeout(time.Second),
+	)
+	go h.record(messageCh)
+	return h
+}
+
+// ListenAndServe は、addr で待ち受けを開始し、Close されるまでクライアントを受け付けます。
+func (h *Hub) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return h.Serve(l)
+}
+
+// Serve は、l でクライアントを受け付けます。Close されると nil を返します。
+func (h *Hub) Serve(l net.Listener) error {
+	h.mu.Lock()
+	if h.done {
+		h.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	h.listener = l
+	h.mu.Unlock()
+
+	slog.Info("Bus hub started", "addr", l.Addr().String())
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("failed to accept bus client: %w", err)
+		}
+		go h.serveConn(conn)
+	}
+}
+
+// Close は、待ち受けを停止し、すべてのクライアントにメッセージを送りきってから接続を閉じます。
+// バスを閉じた後に呼び出してください。
+func (h *Hub) Close() {
+	h.mu.Lock()
+	h.done = true
+	if h.listener != nil {
+		h.listener.Close()
+	}
+	h.mu.Unlock()
+
+	<-h.recorded
+	h.writers.Wait()
+}
+
+// record は、バスに流れたメッセージを履歴に残し、接続中のすべてのクライアントに送ります。
+// バスが閉じられたら、送りきった後にクライアントとの接続を閉じます。
+func (h *Hub) record(messageCh <-chan *message.Message) {
+	defer close(h.recorded)
+	for msg := range messageCh {
+		var lagging []string
+		h.mu.Lock()
+		h.appendHistoryLocked(msg)
+		for c := range h.conns {
+			select {
+			case c.out <- msg:
+			default:
+				// 受信が追いつかないクライアントは切断します。再接続すれば履歴から追いつけます。
+				lagging = append(lagging, c.name)
+				h.removeLocked(c)
+			}
+		}
+		h.mu.Unlock()
+
+		// ログもこのバスに流れるため、ロックを外してから書きます。
+		for _, name := range lagging {
+			slog.Warn("Bus client fell behind, disconnecting", "client", name)
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// バスが閉じられた後は、新しいクライアントを受け付けません。
+	h.done = true
+	for c := range h.conns {
+		// 書き出しは、out に残っているメッセージを送りきってから止まります。
+		delete(h.conns, c)
+		close(c.out)
+	}
+}
+
+// appendHistoryLocked は、メッセージを履歴に加え、historySize を超えた古いメッセージを捨てます。
+func (h *Hub) appendHistoryLocked(msg *message.Message) {
+	h.history = append(h.history, msg)
+	if msg.ID != "" {
+		h.seen[msg.ID] = true
+	}
+	if len(h.history) > historySize {
+		old := h.history[0]
+		h.history[0] = nil
+		h.history = h.history[1:]
+		delete(h.seen, old.ID)
+	}
+}
+
+// removeLocked は、接続を登録から外し、その接続への書き出しを止めます。
+// 読まないクライアントへの書き込みで止まっている書き出しも、接続を閉じて止めます。
+// すでに外れている接続に対しては何もしません。
+func (h *Hub) removeLocked(c *hubConn) {
+	if _, ok := h.conns[c]; !ok {
+		return
+	}
+	delete(h.conns, c)
+	close(c.gone)
+	c.conn.Close()
+}
+
+func (h *Hub) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var hello Frame
+	if !scanner.Scan() {
+		return
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &hello); err != nil || hello.Type != FrameHello || hello.Hello == nil {
+		slog.Warn("Bus client did not send hello, closing", "remote", conn.RemoteAddr().String())
+		return
+	}
+
+	// 別のハブで数えた Seq は、このハブの Seq と比べられないため、履歴を初めから送ります。
+	since := hello.Hello.Since
+	if hello.Hello.Epoch != h.epoch {
+		since = 0
+	}
+
+	c := &hubConn{
+		conn: conn,
+		name: hello.Hello.Name,
+		out:  make(chan *message.Message, connBufferSize),
+		gone: make(chan struct{}),
+	}
+
+	// 履歴の取り出しと登録を同じロックの中で行い、取りこぼしも重複もなく送れるようにします。
+	h.mu.Lock()
+	if h.done {
+		h.mu.Unlock()
+		return
+	}
+	var backlog []*message.Message
+	for _, m := range h.history {
+		if m.Seq > since {
+			backlog = append(backlog, m)
+		}
+	}
+	truncated := len(h.history) > 0 && h.history[0].Seq > since+1
+	h.conns[c] = struct{}{}
+	h.writers.Add(1)
+	h.mu.Unlock()
+
+	slog.Info("Bus client connected", "client", c.name, "remote", conn.RemoteAddr().String(), "since", since)
+	if truncated {
+		slog.Warn("Bus client asked for messages no longer in the history, sending what is left", "client", c.name, "since", since)
+	}
+
+	go h.writeLoop(c, backlog)
+
+	for scanner.Scan() {
+		var f Frame
+		if err := json.Unmarshal(scanner.Bytes(), &f); err != nil {
+			slog.Warn("Bus client sent an invalid frame, closing", "client", c.name, "error", err)
+			break
+		}
+		if err := h.receive(&f); err != nil {
+			slog.Warn("Bus client sent an unusable frame", "client", c.name, "error", err)
+		}
+	}
+
+	h.mu.Lock()
+	h.removeLocked(c)
+	h.mu.Unlock()
+	slog.Info("Bus client disconnected", "client", c.name)
+}
+
+// receive は、クライアントから届いたフレームを処理します。
+func (h *Hub) receive(f *Frame) error {
+	switch f.Type {
+	case FramePersona:
+		if f.Persona == nil {
+			return fmt.Errorf("persona frame without persona")
+		}
+		h.mu.Lock()
+		if _, ok := h.personas[f.Persona.PersonaId]; !ok {
+			h.personas[f.Persona.PersonaId] = f.Persona.ToPersona()
+		}
+		h.mu.Unlock()
+	case FrameMessage:
+		if f.Message == nil {
+			return fmt.Errorf("message frame without message")
+		}
+		if err := f.Message.Validate(); err != nil {
+			return err
+		}
+		h.mu.Lock()
+		if f.Message.ID != "" && h.seen[f.Message.ID] {
+			h.mu.Unlock()
+			return nil
+		}
+		var from *persona.Persona
+		if f.Message.From != "" {
+			p, ok := h.personas[f.Message.From]
+			if !ok {
+				h.mu.Unlock()
+				return fmt.Errorf("message refers to unknown persona '%s'", f.Message.From)
+			}
+			from = p
+		}
+		if f.Message.ID != "" {
+			h.seen[f.Message.ID] = true
+		}
+		h.mu.Unlock()
+
+		m := f.Message.ToMessage(from)
+		// 通し番号はハブのバスで割り当て直します。
+		m.Seq = 0
+		return h.bus.Broadcast(m)
+	}
+	// 未知の種類のフレームは、新しいバージョンのクライアントが送ったものとして無視します。
+	return nil
+}
+
+// writeLoop は、ハブの Epoch を伝えた後、履歴と、その後に届いたメッセージを順にクライアントに書き出します。
+func (h *Hub) writeLoop(c *hubConn, backlog []*message.Message) {
+	defer h.writers.Done()
+	defer c.conn.Close()
+	w := newFrameWriter(c.conn)
+
+	if err := w.write(&Frame{Type: FrameHello, Hello: &Hello{Name: "hub", Epoch: h.epoch}}); err != nil {
+		return
+	}
+	for _, m := range backlog {
+		if err := w.writeMessage(m); err != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case m, ok := <-c.out:
+			if !ok {
+				return
+			}
+			if err := w.writeMessage(m); err != nil {
+				return
+			}
+		case <-c.gone:
+			return
+		}
+	}
+}
+
+// frameWriter は、ひとつの接続にフレームを書き出します。
+// ペルソナの定義は、その接続で初めて参照される前に一度だけ書き出します。
+type frameWriter struct {
+	conn     net.Conn
+	encoder  *json.Encoder
+	personas map[string]bool
+}
+
+func newFrameWriter(conn net.Conn) *frameWriter {
+	return &frameWriter{
+		conn:     conn,
+		encoder:  json.NewEncoder(conn),
+		personas: make(map[string]bool),
+	}
+}
+
+// write は、フレームを1行書き出します。writeTimeout 以内に書き出せなければエラーを返します。
+func (w *frameWriter) write(f *Frame) error {
+	w.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return w.encoder.Encode(f)
+}
+
+func (w *frameWriter) writeMessage(m *message.Message) error {
+	if p := m.From; p != nil && !w.personas[p.PersonaId] {
+		if err := w.write(&Frame{Type: FramePersona, Persona: journal.NewPersonaRecord(p)}); err != nil {
+			return err
+		}
+		w.personas[p.PersonaId] = true
+	}
+	return w.write(&Frame{Type: FrameMessage, Message: journal.NewMessageRecord(m)})
+}
@@ -0,0 +1,80 @@
+package netbus
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	buspkg "github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/message"
+)
+
+// startHub は、b を公開する Hub をループバックの空いているポートで起動します。
+func startHub(t *testing.T, b buspkg.Bus) (*Hub, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	h := NewHub(b)
+	go h.Serve(l)
+	return h, l.Addr().String()
+}
+
+// waitForConns は、ハブに n 個の接続が登録されるまで待ちます。
+func waitForConns(t *testing.T, h *Hub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		h.mu.Lock()
+		registered := len(h.conns)
+		h.mu.Unlock()
+		if registered == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("hub did not register %d connections", n)
+}
+
+// TestHubCloseWithClientThatNeverReads は、接続したまま受信しないクライアントがいても、
+// Close が書き出しを打ち切って戻ることを確かめます。
+func TestHubCloseWithClientThatNeverReads(t *testing.T) {
+	defer func(d time.Duration) { writeTimeout = d }(writeTimeout)
+	writeTimeout = 200 * time.Millisecond
+
+	b := buspkg.NewMemoryBus()
+	h, addr := startHub(t, b)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(&Frame{Type: FrameHello, Hello: &Hello{Name: "stalled"}}); err != nil {
+		t.Fatalf("send hello: %v", err)
+	}
+	waitForConns(t, h, 1)
+
+	// ソケットのバッファに収まりきらない量を流し、ハブの書き込みを止めます。
+	text := strings.Repeat("あ", 64*1024)
+	for i := 0; i < 200; i++ {
+		if err := b.Broadcast(&message.Message{Kind: message.KindSystem, Text: text}); err != nil {
+			t.Fatalf("broadcast: %v", err)
+		}
+	}
+	b.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		h.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Hub.Close did not return while a client was not reading")
+	}
+}
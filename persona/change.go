@@ -0,0 +1,71 @@
+package persona
+
+import "sort"
+
+// DefaultDramaticSwing は、RelationshipChanges に渡す dramaticSwing の既定値です。
+const DefaultDramaticSwing = 30
+
+// RelationshipChange は、ある相手への関係性の、セッションの前後での変化です。
+type RelationshipChange struct {
+	TargetPersonaId string
+	// Before は、セッション開始時点の関係性です。このセッションで初めて関係を築いた場合は nil です。
+	Before *Relationship
+	After  *Relationship
+	// AffinityDelta は、親密度の変化量です。初めて関係を築いた場合は 0 からの変化とします。
+	AffinityDelta int
+	// Dramatic は、親密度が大きく動いたか、好意と反感が入れ替わった場合に true です。
+	Dramatic bool
+}
+
+// AffinityBefore は、セッション開始時点の親密度です。初めて関係を築いた場合は 0 です。
+func (c *RelationshipChange) AffinityBefore() int {
+	if c.Before == nil {
+		return 0
+	}
+	return c.Before.Affinity
+}
+
+// ImpressionBefore は、セッション開始時点の印象です。初めて関係を築いた場合は空です。
+func (c *RelationshipChange) ImpressionBefore() string {
+	if c.Before == nil {
+		return ""
+	}
+	return c.Before.Impression
+}
+
+// ImpressionChanged は、印象が書き換わった場合に true を返します。
+func (c *RelationshipChange) ImpressionChanged() bool {
+	return c.ImpressionBefore() != c.After.Impression
+}
+
+// RelationshipChanges は、InitialRelationships と Relationships を比べ、このセッションで変わった関係性を
+// 相手の PersonaId の順に返します。
+// 親密度が dramaticSwing 以上動いた場合と、好意と反感が入れ替わった場合は、劇的な変化として Dramatic を立てます。
+// dramaticSwing が 0 以下の場合は、好意と反感の入れ替わりだけを劇的な変化とみなします。
+func (p *Persona) RelationshipChanges(dramaticSwing int) []*RelationshipChange {
+	targetIds := make([]string, 0, len(p.Relationships))
+	for id := range p.Relationships {
+		targetIds = append(targetIds, id)
+	}
+	sort.Strings(targetIds)
+
+	var changes []*RelationshipChange
+	for _, id := range targetIds {
+		after := p.Relationships[id]
+		before := p.InitialRelationships[id]
+		if before != nil && *before == *after {
+			continue
+		}
+
+		c := &RelationshipChange{TargetPersonaId: id, Before: before, After: after}
+		c.AffinityDelta = after.Affinity - c.AffinityBefore()
+		swing := c.AffinityDelta
+		if swing < 0 {
+			swing = -swing
+		}
+		flipped := c.AffinityBefore()*after.Affinity < 0
+		c.Dramatic = flipped || (dramaticSwing > 0 && swing >= dramaticSwing)
+		changes = append(changes, c)
+	}
+	return changes
+}
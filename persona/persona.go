@@ -16,6 +16,16 @@ type Relationship struct {
 	Impression      string `yaml:"impression"`
 }
 
+// Voice は、音声合成でペルソナの声に使う設定です。
+type Voice struct {
+	// Name は、音声合成エンジンの声の名前です (例: ja-JP-Neural2-B)。空の場合は Gender から選ばせます。
+	Name string `yaml:"name"`
+	// Rate は、話す速さの倍率です。0 の場合は 1.0 (標準) として扱います。
+	Rate float64 `yaml:"rate"`
+	// Pitch は、声の高さを半音単位でずらす量です。
+	Pitch float64 `yaml:"pitch"`
+}
+
 // Persona は、Cha の人格（ペルソナ）を定義します。
 // この情報は、LLMに渡すプロンプトのベースとなります。
 type Persona struct {
@@ -30,9 +40,12 @@ type Persona struct {
 	DefaultMaxChars int      `yaml:"defaultMaxChars"`
 	SpeakProb       float64  `yaml:"speakProb"`
 	MinGapSeconds   int      `yaml:"minGapSeconds"`
+	Voice           Voice    `yaml:"voice"`
 
 	// --- 動的データ (data/relationships/ から) ---
 	// 他のペルソナへの関係性を保持するマップ
 	// キー: 相手のペルソナの PersonaId
 	Relationships map[string]*Relationship `yaml:"-"` // このフィールドはYAMLの直接の対象外
+	// セッション開始時点の関係性。LoadForPersona が読み込んだ内容の複製で、セッション中は変わりません。
+	InitialRelationships map[string]*Relationship `yaml:"-"`
 }
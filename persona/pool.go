@@ -4,6 +4,7 @@ import (
 	_ "embed"
 	"fmt"
 	"math/rand"
+	"os"
 
 	"github.com/sat8bit/kaigi/configs"
 	"gopkg.in/yaml.v3"
@@ -18,18 +19,28 @@ func NewPool() (*Pool, error) {
 	return &p, nil
 }
 
+// LoadFromFile は、ひとつのペルソナを定義したYAMLファイルを読み込みます。
+// 形式は configs/personas.yaml の各要素と同じです。
+func LoadFromFile(path string) (*Persona, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read persona file %s: %w", path, err)
+	}
+	var p Persona
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal persona file %s: %w", path, err)
+	}
+	if p.PersonaId == "" || p.DisplayName == "" {
+		return nil, fmt.Errorf("persona file %s must define personaId and displayName", path)
+	}
+	return &p, nil
+}
+
 type Pool struct {
 	// Personas は、読み込まれた Persona のスライスです。
 	Personas []*Persona `yaml:"personas"`
 }
 
-func (p *Pool) GetAll() []*Persona {
-	if p == nil {
-		return nil
-	}
-	return p.Personas
-}
-
 func (p *Pool) GetByPersonaId(personaId string) (*Persona, error) {
 	for _, persona := range p.Personas {
 		if persona.PersonaId == personaId {
@@ -39,11 +50,15 @@ func (p *Pool) GetByPersonaId(personaId string) (*Persona, error) {
 	return nil, fmt.Errorf("persona with id '%s' not found", personaId)
 }
 
+// GetRandomN は、ランダムに選んだ n 人のペルソナを返します。n が 0 以下の場合は誰も選びません。
 func (p *Pool) GetRandomN(n int) ([]*Persona, error) {
+	if n <= 0 {
+		return nil, nil
+	}
 	if p == nil || len(p.Personas) == 0 {
 		return nil, fmt.Errorf("no Personas available")
 	}
-	if n <= 0 || n > len(p.Personas) {
+	if n > len(p.Personas) {
 		n = len(p.Personas)
 	}
 
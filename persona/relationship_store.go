@@ -19,8 +19,10 @@ func NewRelationshipStore(dataDir string) *RelationshipStore {
 }
 
 // LoadForPersona は、指定されたペルソナの Relationships マップをファイルから読み込み、設定します。
+// 読み込んだ内容の複製を、セッション開始時点の関係性として InitialRelationships に残します。
 func (s *RelationshipStore) LoadForPersona(p *Persona) error {
 	p.Relationships = make(map[string]*Relationship) // 初期化
+	p.InitialRelationships = make(map[string]*Relationship)
 	relPath := filepath.Join(s.dataDir, "relationships", p.PersonaId+".yaml")
 
 	if _, err := os.Stat(relPath); os.IsNotExist(err) {
@@ -39,6 +41,8 @@ func (s *RelationshipStore) LoadForPersona(p *Persona) error {
 
 	for _, r := range rels {
 		p.Relationships[r.TargetPersonaId] = r
+		initial := *r
+		p.InitialRelationships[r.TargetPersonaId] = &initial
 	}
 	return nil
 }
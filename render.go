@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	buspkg "github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/journal"
+	"github.com/sat8bit/kaigi/renderer"
+)
+
+// runRender は、保存済みのジャーナルを LLM を呼ばずにレンダラーへ流し直します。
+//
+//	kaigi render [-renderers markdown] [-output dir] <journal.jsonl>...
+func runRender(args []string) {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	var (
+		renderersStr = fs.String("renderers", "markdown", "Comma-separated list of renderers to use ("+strings.Join(renderer.Names(), ", ")+"; web is not available here)")
+		flags        = registerRendererFlags(fs)
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s render [flags] <journal.jsonl>...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// ジャーナルの再生は対話的ではないため、ターン数の上限は表示せず、キー操作も受け付けません。
+	// 再生はすぐに終わるため、ライブ配信用の web レンダラーは使いません。
+	// LLM も呼ばないため、voice レンダラーは感情を判定しません。
+	opts, err := flags.options(0, false)
+	if err != nil {
+		fmt.Fprintf(fs.Output(), "%v\n", err)
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, path := range fs.Args() {
+		if err := renderJournal(context.Background(), path, *renderersStr, opts); err != nil {
+			slog.Error("failed to render journal", "path", path, "error", err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// renderJournal は、ジャーナルをひとつ読み込み、レンダラーへ流し直します。
+// セッションは、ジャーナルに記録された終了時刻や終了の理由で終えた状態でレンダラーに渡します。
+func renderJournal(ctx context.Context, path, renderersStr string, opts *renderer.Options) error {
+	j, err := journal.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	slog.Info("Rendering journal", "path", path, "sessionId", j.Session.ID, "messages", len(j.Messages))
+
+	bus := buspkg.NewMemoryBus()
+	var wg sync.WaitGroup
+
+	activeRenderers, err := renderer.Build(renderersStr, opts)
+	if err != nil {
+		return err
+	}
+	// 再生に失敗した場合も、バスを閉じてレンダラーの購読を終わらせます。
+	defer func() {
+		bus.Close()
+		wg.Wait()
+	}()
+	for _, r := range activeRenderers {
+		if err := r.Render(ctx, j.Session, bus, &wg); err != nil {
+			return fmt.Errorf("failed to start renderer: %w", err)
+		}
+	}
+
+	if err := j.Replay(bus); err != nil {
+		return err
+	}
+	bus.Close()
+	wg.Wait()
+
+	return finalizeRenderers(ctx, j.Session, activeRenderers)
+}
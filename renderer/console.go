@@ -1,49 +1,245 @@
 package renderer
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"sync"
 	"time"
 
-	"github.com/sat8bit/kaigi/bus"
+	buspkg "github.com/sat8bit/kaigi/bus"
 	"github.com/sat8bit/kaigi/message"
-	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/session"
 )
 
-func NewConsoleRenderer() *ConsoleRenderer {
-	return &ConsoleRenderer{}
+// ConsoleMode は、コンソールへの表示の形式です。
+type ConsoleMode string
+
+const (
+	// ConsoleModePlain は、発言やお知らせを1行ずつ書き出します。パイプやファイルへの出力にも使えます。
+	ConsoleModePlain ConsoleMode = "plain"
+	// ConsoleModeTUI は、ANSI エスケープシーケンスで画面を描き直し、会話の横に親密度とターン数を表示します。
+	ConsoleModeTUI ConsoleMode = "tui"
+)
+
+// ParseConsoleMode は、文字列を ConsoleMode に変換します。
+func ParseConsoleMode(s string) (ConsoleMode, error) {
+	switch m := ConsoleMode(s); m {
+	case ConsoleModePlain, ConsoleModeTUI:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown console mode '%s'", s)
+}
+
+// ConsoleConfig は、コンソールへの表示の設定です。
+type ConsoleConfig struct {
+	Mode ConsoleMode
+	// TypingDelay は、発言を1文字ずつ表示するときの間隔です。0 の場合は発言を一度に表示します。
+	TypingDelay time.Duration
+	// ShowLog は、ログ (message.KindLog) を表示するかどうかの初期値です。
+	ShowLog bool
+	// MaxTurns は、ターン数の上限です。TUI でターン数と並べて表示します。0 の場合は上限を表示しません。
+	MaxTurns int
+	// Keys は、TUI でキー操作を読み込む端末です。nil の場合はキー操作を受け付けません。
+	// 標準入力を人間の参加者が使う場合は nil にします。
+	Keys *os.File
+}
+
+func init() {
+	Register("console", func(o *Options) (Renderer, error) {
+		return NewConsoleRenderer(o.Console, o.DramaticSwing), nil
+	})
+}
+
+// NewConsoleRenderer は、会話を標準出力に流すレンダラーを生成します。
+func NewConsoleRenderer(cfg ConsoleConfig, dramaticSwing int) *ConsoleRenderer {
+	return &ConsoleRenderer{
+		cfg:           cfg,
+		dramaticSwing: dramaticSwing,
+		out:           os.Stdout,
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// ConsoleRenderer は、会話をコンソールに表示します。
+// バスからの受信と表示を別の goroutine で行うため、1文字ずつの表示に時間がかかってもバスの購読は遅れません。
+// 表示が追いつかない場合は、溜まった発言を一度に表示して追いつきます。
+type ConsoleRenderer struct {
+	cfg           ConsoleConfig
+	dramaticSwing int
+	out           io.Writer
+	tui           *consoleTUI
+
+	mu     sync.Mutex
+	queue  []*message.Message
+	closed bool
+	wake   chan struct{}
 }
 
-type ConsoleRenderer struct{}
+func (c *ConsoleRenderer) Render(ctx context.Context, sess *session.Session, b buspkg.Bus, wg *sync.WaitGroup) error {
+	// 画面を作れなかった場合に購読が残らないよう、画面を作ってから購読します。
+	if c.cfg.Mode == ConsoleModeTUI {
+		tui, err := newConsoleTUI(c.out, c.cfg, sess)
+		if err != nil {
+			return err
+		}
+		c.tui = tui
+	}
+
+	ch := b.Subscribe(buspkg.WithName("console"), buspkg.WithPolicy(buspkg.PolicyDropOldest))
 
-func (c *ConsoleRenderer) Render(bus bus.Bus, wg *sync.WaitGroup) error {
-	ch := bus.Subscribe()
+	displayed := make(chan struct{})
+	go func() {
+		defer close(displayed)
+		c.display()
+	}()
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		for o := range ch {
-			switch o.Kind {
-			case message.KindSystem:
-				fmt.Printf("[System] %s\n", o.Text)
-			case message.KindLog:
-				fmt.Printf("[SysLog]%s\n", o.Text)
-			case message.KindCha:
-				fmt.Printf("%s: ", o.From.DisplayName)
-				for _, r := range o.Text {
-					fmt.Print(string(r))
-					time.Sleep(50 * time.Millisecond)
-				}
-				fmt.Println()
+		for msg := range ch {
+			if c.tui != nil {
+				// 親密度やターン数は、発言の表示を待たずにすぐ反映します。
+				c.tui.observe(msg)
 			}
+			c.mu.Lock()
+			c.queue = append(c.queue, msg)
+			c.mu.Unlock()
+			c.notify()
+		}
+		c.mu.Lock()
+		c.closed = true
+		c.mu.Unlock()
+		c.notify()
+		<-displayed
+		// セッションが途中で失敗して Finalize が呼ばれない場合も、バスが閉じられたら端末を元に戻します。
+		if c.tui != nil {
+			c.tui.close()
 		}
 	}()
 
 	return nil
 }
 
-// Finalize は Renderer インターフェースを実装するためのメソッドです。
-// ConsoleRenderer では特に何も行いません。
-func (c *ConsoleRenderer) Finalize(allPersonas []*persona.Persona) error {
+// Finalize は、画面を通常の状態に戻し、このセッションで変わった関係性を表示します。劇的な変化には ⚡ を付けます。
+func (c *ConsoleRenderer) Finalize(ctx context.Context, sess *session.Session) error {
+	if c.tui != nil {
+		c.tui.close()
+	}
+
+	names := make(map[string]string, len(sess.Participants))
+	for _, p := range sess.Participants {
+		names[p.PersonaId] = p.DisplayName
+	}
+
+	header := false
+	for _, p := range sess.Participants {
+		for _, ch := range p.RelationshipChanges(c.dramaticSwing) {
+			if !header {
+				fmt.Fprintln(c.out, "[System] このセッションでの関係性の変化:")
+				header = true
+			}
+			target := names[ch.TargetPersonaId]
+			if target == "" {
+				target = ch.TargetPersonaId
+			}
+			mark := ""
+			if ch.Dramatic {
+				mark = " ⚡"
+			}
+			if ch.Before == nil {
+				fmt.Fprintf(c.out, "  %s → %s: 親密度 %d (初対面)%s\n", p.DisplayName, target, ch.After.Affinity, mark)
+			} else {
+				fmt.Fprintf(c.out, "  %s → %s: 親密度 %d → %d (%+d)%s\n", p.DisplayName, target, ch.Before.Affinity, ch.After.Affinity, ch.AffinityDelta, mark)
+			}
+			if ch.ImpressionChanged() {
+				fmt.Fprintf(c.out, "    印象: %s\n", ch.After.Impression)
+			}
+		}
+	}
 	return nil
 }
+
+func (c *ConsoleRenderer) notify() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next は、表示待ちの先頭のメッセージを取り出します。バスが閉じられ、表示待ちがなくなった場合は false を返します。
+func (c *ConsoleRenderer) next() (*message.Message, bool) {
+	for {
+		c.mu.Lock()
+		if len(c.queue) > 0 {
+			msg := c.queue[0]
+			c.queue = c.queue[1:]
+			c.mu.Unlock()
+			return msg, true
+		}
+		closed := c.closed
+		c.mu.Unlock()
+		if closed {
+			return nil, false
+		}
+		<-c.wake
+	}
+}
+
+// behind は、表示待ちのメッセージがあるか、バスが閉じられた場合に true を返します。
+// そのときは1文字ずつの表示をやめ、残りを一度に表示します。
+func (c *ConsoleRenderer) behind() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.queue) > 0 || c.closed
+}
+
+// display は、表示待ちのメッセージを順に表示します。
+func (c *ConsoleRenderer) display() {
+	for {
+		msg, ok := c.next()
+		if !ok {
+			return
+		}
+		if c.tui != nil {
+			c.tui.show(msg, c.typewrite)
+		} else {
+			c.print(msg)
+		}
+	}
+}
+
+// typewrite は、n 文字の発言を1文字ずつ表示するため、i 文字目ごとに reveal を呼びます。
+// 表示が遅れている場合は、残りを一度に表示します。
+func (c *ConsoleRenderer) typewrite(n int, reveal func(i int)) {
+	for i := 1; i <= n; i++ {
+		if c.cfg.TypingDelay <= 0 || c.behind() {
+			reveal(n)
+			return
+		}
+		reveal(i)
+		time.Sleep(c.cfg.TypingDelay)
+	}
+}
+
+// print は、plain の形式でメッセージを1行書き出します。
+func (c *ConsoleRenderer) print(o *message.Message) {
+	switch o.Kind {
+	case message.KindSystem, message.KindJoin, message.KindLeave:
+		fmt.Fprintf(c.out, "[System] %s\n", o.Text)
+	case message.KindLog:
+		if c.cfg.ShowLog {
+			fmt.Fprintf(c.out, "[SysLog]%s\n", o.Text)
+		}
+	case message.KindCha:
+		fmt.Fprintf(c.out, "%s: ", o.From.DisplayName)
+		text := []rune(o.Text)
+		written := 0
+		c.typewrite(len(text), func(i int) {
+			fmt.Fprint(c.out, string(text[written:i]))
+			written = i
+		})
+		fmt.Fprintln(c.out)
+	}
+}
@@ -0,0 +1,613 @@
+package renderer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+	"golang.org/x/text/width"
+
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/session"
+)
+
+const (
+	// tuiSideWidth は、親密度を表示する右側の欄の幅です。
+	tuiSideWidth = 32
+	// tuiLogHeight は、ログの欄の最大の行数です。
+	tuiLogHeight = 8
+	// tuiMaxEntries と tuiMaxLogs は、画面に描くために残しておく発言とログの数です。
+	tuiMaxEntries = 500
+	tuiMaxLogs    = 200
+	// tuiToggleLogKey は、ログの欄の表示を切り替えるキーです。
+	tuiToggleLogKey = 'l'
+)
+
+// 端末の大きさが分からない場合に使う大きさです。
+const (
+	tuiDefaultWidth  = 100
+	tuiDefaultHeight = 30
+)
+
+// consoleTUI は、ConsoleModeTUI の画面です。
+// 左に会話、右に参加者ごとの親密度、上にターン数、下に切り替えられるログの欄を描きます。
+// 何かが変わるたびに、画面全体を描き直します。
+type consoleTUI struct {
+	out     io.Writer
+	fd      int
+	cfg     ConsoleConfig
+	session *session.Session
+	// keys は、キー操作を受け付けている場合に true です。
+	keys bool
+	// keyReader は、キー操作を読み込んでこの画面に渡します。キー操作を受け付けない場合は nil です。
+	keyReader *keyReader
+	// restore は、キー操作のために変えた端末の設定を元に戻します。
+	restore func()
+
+	mu           sync.Mutex
+	turn         int
+	participants []*persona.Persona
+	present      map[string]bool
+	typing       map[string]bool
+	// initial は参加時点の、current は最新の関係性です。キーは、関係を持つ側と相手の PersonaId です。
+	initial  map[string]map[string]*persona.Relationship
+	current  map[string]map[string]*persona.Relationship
+	entries  []*tuiEntry
+	logs     []string
+	showLog  bool
+	ended    string
+	closed   bool
+	lastRows int
+}
+
+// tuiEntry は、会話の欄のひとつの項目です。Speaker が nil の場合はお知らせです。
+type tuiEntry struct {
+	speaker *persona.Persona
+	kind    message.Kind
+	text    []rune
+	// shown は、表示済みの文字数です。
+	shown int
+}
+
+// tuiSpan は、同じ色で描く文字列です。
+type tuiSpan struct {
+	text  string
+	style string
+}
+
+// tuiLine は、画面の1行です。
+type tuiLine []tuiSpan
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiInvert = "\x1b[7m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+)
+
+func newConsoleTUI(out io.Writer, cfg ConsoleConfig, sess *session.Session) (*consoleTUI, error) {
+	t := &consoleTUI{
+		out:     out,
+		fd:      -1,
+		cfg:     cfg,
+		session: sess,
+		restore: func() {},
+		present: make(map[string]bool),
+		typing:  make(map[string]bool),
+		initial: make(map[string]map[string]*persona.Relationship),
+		current: make(map[string]map[string]*persona.Relationship),
+		showLog: cfg.ShowLog,
+	}
+	if f, ok := out.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		t.fd = int(f.Fd())
+	}
+
+	if cfg.Keys != nil && term.IsTerminal(int(cfg.Keys.Fd())) {
+		// 1キーずつ読むため、端末を raw モードにします。Ctrl-C はシグナルにならないため、keyReader.read が読んだ 0x03 を consoleTUI.key が割り込みとして送ります。
+		fd := int(cfg.Keys.Fd())
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return nil, fmt.Errorf("failed to put terminal into raw mode: %w", err)
+		}
+		t.restore = func() { term.Restore(fd, state) }
+		t.keys = true
+		t.keyReader = keyReaderFor(cfg.Keys)
+		t.keyReader.attach(t)
+	}
+
+	// 画面を消し、カーソルを隠します。
+	fmt.Fprint(t.out, "\x1b[2J\x1b[?25l")
+	t.mu.Lock()
+	t.draw()
+	t.mu.Unlock()
+	return t, nil
+}
+
+// keyReader は、端末からキー操作を読み込み、そのときに開いている画面に渡します。
+// 読み込みの途中の Read は止められないため、端末ごとにひとつだけ起動し、セッションをまたいで使い回します。
+// 画面が開いていない間に押されたキーは捨てます。
+type keyReader struct {
+	mu     sync.Mutex
+	target *consoleTUI
+}
+
+var (
+	keyReadersMu sync.Mutex
+	keyReaders   = make(map[*os.File]*keyReader)
+)
+
+// keyReaderFor は、keys を読み込む keyReader を返します。初めて呼ばれたときに読み込みを始めます。
+func keyReaderFor(keys *os.File) *keyReader {
+	keyReadersMu.Lock()
+	defer keyReadersMu.Unlock()
+	if r, ok := keyReaders[keys]; ok {
+		return r
+	}
+	r := &keyReader{}
+	keyReaders[keys] = r
+	go r.read(keys)
+	return r
+}
+
+// attach は、キー操作を t に渡すようにします。
+func (r *keyReader) attach(t *consoleTUI) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.target = t
+}
+
+// detach は、t がキー操作を受け取っている場合に、受け取りをやめさせます。
+func (r *keyReader) detach(t *consoleTUI) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.target == t {
+		r.target = nil
+	}
+}
+
+// read は、キー操作を読み込みます。端末を閉じるまで戻りません。
+func (r *keyReader) read(keys io.Reader) {
+	buf := make([]byte, 1)
+	for {
+		if _, err := keys.Read(buf); err != nil {
+			return
+		}
+		r.mu.Lock()
+		t := r.target
+		r.mu.Unlock()
+		if t != nil {
+			t.key(buf[0])
+		}
+	}
+}
+
+// key は、押されたキーを処理します。
+func (t *consoleTUI) key(k byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	switch k {
+	case tuiToggleLogKey, tuiToggleLogKey - 'a' + 'A':
+		t.showLog = !t.showLog
+		t.draw()
+	case 0x03: // Ctrl-C
+		if p, err := os.FindProcess(os.Getpid()); err == nil {
+			p.Signal(os.Interrupt)
+		}
+	}
+}
+
+// observe は、バスから受け取ったメッセージを、発言の表示を待たずに親密度やターン数に反映します。
+func (t *consoleTUI) observe(msg *message.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch msg.Kind {
+	case message.KindJoin:
+		t.join(msg.From)
+		t.present[msg.From.PersonaId] = true
+	case message.KindLeave:
+		t.present[msg.From.PersonaId] = false
+		t.typing[msg.From.PersonaId] = false
+	case message.KindTyping:
+		t.typing[msg.From.PersonaId] = true
+	case message.KindCha:
+		t.join(msg.From)
+		t.turn++
+		t.typing[msg.From.PersonaId] = false
+	case message.KindRelationship:
+		if msg.From == nil || msg.Relationship == nil {
+			return
+		}
+		t.join(msg.From)
+		rel := *msg.Relationship
+		t.current[msg.From.PersonaId][rel.TargetPersonaId] = &rel
+	case message.KindLog:
+		t.logs = append(t.logs, msg.Text)
+		if len(t.logs) > tuiMaxLogs {
+			t.logs = t.logs[len(t.logs)-tuiMaxLogs:]
+		}
+		if !t.showLog {
+			return
+		}
+	case message.KindEnd:
+		t.ended = msg.Text
+	default:
+		return
+	}
+	t.draw()
+}
+
+// join は、初めて現れたペルソナを参加者に加え、参加時点の関係性を控えます。
+func (t *consoleTUI) join(p *persona.Persona) {
+	if _, ok := t.current[p.PersonaId]; ok {
+		return
+	}
+	t.participants = append(t.participants, p)
+	t.initial[p.PersonaId] = make(map[string]*persona.Relationship)
+	t.current[p.PersonaId] = make(map[string]*persona.Relationship)
+	// Relationships はセッション中に書き換わるため、変わらない InitialRelationships から写します。
+	for id, rel := range p.InitialRelationships {
+		r := *rel
+		t.initial[p.PersonaId][id] = &r
+		c := *rel
+		t.current[p.PersonaId][id] = &c
+	}
+}
+
+// show は、メッセージを会話の欄に加えます。発言は typewrite で1文字ずつ表示します。
+func (t *consoleTUI) show(msg *message.Message, typewrite func(n int, reveal func(i int))) {
+	var e *tuiEntry
+	switch msg.Kind {
+	case message.KindCha:
+		e = &tuiEntry{speaker: msg.From, kind: msg.Kind, text: []rune(msg.Text)}
+	case message.KindSystem, message.KindJoin, message.KindLeave, message.KindError:
+		e = &tuiEntry{kind: msg.Kind, text: []rune(msg.Text)}
+		e.shown = len(e.text)
+	default:
+		return
+	}
+
+	t.mu.Lock()
+	t.entries = append(t.entries, e)
+	if len(t.entries) > tuiMaxEntries {
+		t.entries = t.entries[len(t.entries)-tuiMaxEntries:]
+	}
+	t.draw()
+	t.mu.Unlock()
+
+	if e.speaker != nil {
+		typewrite(len(e.text), func(i int) {
+			t.mu.Lock()
+			e.shown = i
+			t.draw()
+			t.mu.Unlock()
+		})
+	}
+}
+
+// close は、最後の画面を描き、カーソルを画面の下に移して端末を元に戻します。
+func (t *consoleTUI) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+	t.draw()
+	t.closed = true
+	if t.keyReader != nil {
+		t.keyReader.detach(t)
+	}
+	t.restore()
+	fmt.Fprintf(t.out, "\x1b[%d;1H\x1b[?25h\n", t.lastRows)
+}
+
+// size は、端末の大きさを返します。
+func (t *consoleTUI) size() (int, int) {
+	if t.fd >= 0 {
+		if w, h, err := term.GetSize(t.fd); err == nil && w > 0 && h > 0 {
+			return w, h
+		}
+	}
+	return tuiDefaultWidth, tuiDefaultHeight
+}
+
+// draw は、画面全体を描き直します。t.mu を持った状態で呼び出します。
+func (t *consoleTUI) draw() {
+	if t.closed {
+		return
+	}
+	w, h := t.size()
+
+	sideW := tuiSideWidth
+	if w < tuiSideWidth*2 {
+		sideW = 0
+	}
+	convW := w
+	if sideW > 0 {
+		convW = w - sideW - 1
+	}
+	logH := 0
+	if t.showLog {
+		logH = min(tuiLogHeight, h/3)
+	}
+	bodyH := h - 2
+	if logH > 0 {
+		bodyH -= logH + 1
+	}
+	if bodyH < 1 {
+		bodyH = 1
+	}
+
+	var rows []tuiLine
+	rows = append(rows, t.header(w))
+
+	conv := t.conversation(convW)
+	if len(conv) > bodyH {
+		conv = conv[len(conv)-bodyH:]
+	}
+	side := t.sidePanel(sideW)
+	for i := 0; i < bodyH; i++ {
+		var row tuiLine
+		if i < len(conv) {
+			row = append(row, conv[i]...)
+		}
+		if sideW > 0 {
+			row = append(fitLine(row, convW), tuiSpan{text: "│", style: ansiDim})
+			if i < len(side) {
+				row = append(row, side[i]...)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	if logH > 0 {
+		rows = append(rows, tuiLine{{text: "─ ログ " + strings.Repeat("─", max(0, w-7)), style: ansiDim}})
+		logs := t.logs
+		if len(logs) > logH {
+			logs = logs[len(logs)-logH:]
+		}
+		for i := 0; i < logH; i++ {
+			if i < len(logs) {
+				rows = append(rows, tuiLine{{text: logs[i], style: ansiDim}})
+			} else {
+				rows = append(rows, nil)
+			}
+		}
+	}
+	rows = append(rows, t.footer())
+
+	var b strings.Builder
+	for i, row := range rows {
+		fmt.Fprintf(&b, "\x1b[%d;1H", i+1)
+		writeLine(&b, fitLine(row, w))
+		b.WriteString("\x1b[K")
+	}
+	t.lastRows = len(rows)
+	io.WriteString(t.out, b.String())
+}
+
+func (t *consoleTUI) header(w int) tuiLine {
+	left := " kAIgi  セッション " + t.session.ID
+	right := fmt.Sprintf("ターン %d ", t.turn)
+	if t.cfg.MaxTurns > 0 {
+		right = fmt.Sprintf("ターン %d/%d ", t.turn, t.cfg.MaxTurns)
+	}
+	gap := max(1, w-displayWidth(left)-displayWidth(right))
+	return tuiLine{{text: left + strings.Repeat(" ", gap) + right, style: ansiInvert}}
+}
+
+func (t *consoleTUI) footer() tuiLine {
+	state := "表示"
+	if t.showLog {
+		state = "隠す"
+	}
+	var line tuiLine
+	if t.ended != "" {
+		line = append(line, tuiSpan{text: " 終了: " + t.ended + " ", style: ansiYellow + ansiBold})
+	}
+	if t.keys {
+		line = append(line, tuiSpan{text: fmt.Sprintf(" [%c] ログを%s  [Ctrl-C] 終了", tuiToggleLogKey, state), style: ansiDim})
+	}
+	return line
+}
+
+// conversation は、会話の欄を幅 w で折り返した行にします。
+func (t *consoleTUI) conversation(w int) []tuiLine {
+	var lines []tuiLine
+	for _, e := range t.entries {
+		text := strings.ReplaceAll(string(e.text[:e.shown]), "\n", " ")
+		if e.speaker == nil {
+			style := ansiDim
+			if e.kind == message.KindError {
+				style = ansiRed
+			}
+			for _, l := range wrapWidth("・"+text, w) {
+				lines = append(lines, tuiLine{{text: l, style: style}})
+			}
+			continue
+		}
+
+		name := e.speaker.DisplayName + ": "
+		nameW := displayWidth(name)
+		wrapped := wrapWidth(strings.Repeat(" ", nameW)+text, w)
+		for i, l := range wrapped {
+			if i == 0 {
+				// 折り返しの幅に話者名を含めるため、空白で場所を取ってから名前に置き換えます。
+				lines = append(lines, tuiLine{
+					{text: name, style: personaColor(e.speaker) + ansiBold},
+					{text: trimWidth(l, nameW)},
+				})
+				continue
+			}
+			lines = append(lines, tuiLine{{text: l}})
+		}
+	}
+	return lines
+}
+
+// sidePanel は、参加者ごとの親密度の欄を幅 w の行にします。
+func (t *consoleTUI) sidePanel(w int) []tuiLine {
+	if w <= 0 {
+		return nil
+	}
+	names := make(map[string]string, len(t.participants))
+	for _, p := range t.participants {
+		names[p.PersonaId] = p.DisplayName
+	}
+
+	lines := []tuiLine{{{text: " 親密度", style: ansiBold}}}
+	for _, p := range t.participants {
+		style := personaColor(p) + ansiBold
+		status := ""
+		switch {
+		case !t.present[p.PersonaId]:
+			style = ansiDim
+			status = " (退室)"
+		case t.typing[p.PersonaId]:
+			status = " …"
+		}
+		lines = append(lines, tuiLine{{text: " " + p.DisplayName, style: style}, {text: status, style: ansiDim}})
+
+		rels := t.current[p.PersonaId]
+		for _, q := range t.participants {
+			rel, ok := rels[q.PersonaId]
+			if !ok {
+				continue
+			}
+			line := tuiLine{{text: fmt.Sprintf("   → %s %4d", names[q.PersonaId], rel.Affinity)}}
+			if before, ok := t.initial[p.PersonaId][q.PersonaId]; !ok {
+				line = append(line, tuiSpan{text: " new", style: ansiYellow})
+			} else if delta := rel.Affinity - before.Affinity; delta > 0 {
+				line = append(line, tuiSpan{text: fmt.Sprintf(" ▲+%d", delta), style: ansiGreen})
+			} else if delta < 0 {
+				line = append(line, tuiSpan{text: fmt.Sprintf(" ▼%d", delta), style: ansiRed})
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// personaColor は、ペルソナごとに決まる文字色を返します。HTML の出力と同じく、PersonaId から色相を決めます。
+func personaColor(p *persona.Persona) string {
+	h := fnv.New32a()
+	h.Write([]byte(p.PersonaId))
+	r, g, b := hslToRGB(float64(h.Sum32()%360), 0.55, 0.6)
+	return fmt.Sprintf("\x1b[38;2;%d;%d;%dm", r, g, b)
+}
+
+func hslToRGB(h, s, l float64) (int, int, int) {
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return int((r + m) * 255), int((g + m) * 255), int((b + m) * 255)
+}
+
+// runeWidth は、端末で文字が占める幅を返します。全角の文字は 2 です。
+func runeWidth(r rune) int {
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// wrapWidth は、文字列を表示幅 w ごとに折り返します。
+func wrapWidth(s string, w int) []string {
+	if w <= 0 {
+		return []string{s}
+	}
+	var lines []string
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		rw := runeWidth(r)
+		if n+rw > w {
+			lines = append(lines, b.String())
+			b.Reset()
+			n = 0
+		}
+		b.WriteRune(r)
+		n += rw
+	}
+	return append(lines, b.String())
+}
+
+// trimWidth は、文字列の先頭から表示幅 w の分を取り除きます。
+func trimWidth(s string, w int) string {
+	n := 0
+	for i, r := range s {
+		if n >= w {
+			return s[i:]
+		}
+		n += runeWidth(r)
+	}
+	return ""
+}
+
+// fitLine は、行を表示幅 w に切り詰め、足りない分を空白で埋めます。
+func fitLine(line tuiLine, w int) tuiLine {
+	var fitted tuiLine
+	n := 0
+	for _, span := range line {
+		var b strings.Builder
+		for _, r := range span.text {
+			rw := runeWidth(r)
+			if n+rw > w {
+				break
+			}
+			b.WriteRune(r)
+			n += rw
+		}
+		fitted = append(fitted, tuiSpan{text: b.String(), style: span.style})
+	}
+	if n < w {
+		fitted = append(fitted, tuiSpan{text: strings.Repeat(" ", w-n)})
+	}
+	return fitted
+}
+
+func writeLine(b *strings.Builder, line tuiLine) {
+	for _, span := range line {
+		if span.style == "" {
+			b.WriteString(span.text)
+			continue
+		}
+		b.WriteString(span.style + span.text + ansiReset)
+	}
+}
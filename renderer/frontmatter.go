@@ -0,0 +1,126 @@
+package renderer
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// FrontMatterFormat は、Markdown の先頭に書き出す Hugo の front matter の形式です。
+type FrontMatterFormat string
+
+const (
+	// FrontMatterTOML は、+++ で囲んだ TOML の front matter です。
+	FrontMatterTOML FrontMatterFormat = "toml"
+	// FrontMatterYAML は、--- で囲んだ YAML の front matter です。
+	FrontMatterYAML FrontMatterFormat = "yaml"
+)
+
+// front matter に追加できる項目です。FrontMatterConfig.Fields に指定します。
+const (
+	// FieldSlug は、セッションIDを slug として書き出します。ファイル名を変えても URL が変わらなくなります。
+	FieldSlug = "slug"
+	// FieldDescription は、最初の話題の要約を description として書き出します。
+	FieldDescription = "description"
+	// FieldSource は、最初の話題の URL を sourceUrl として書き出します。
+	FieldSource = "source"
+	// FieldPersonas は、参加者の PersonaId の一覧を personas として書き出します。
+	FieldPersonas = "personas"
+	// FieldSession は、セッションIDを sessionId として書き出します。
+	FieldSession = "session"
+)
+
+// FrontMatterFields は、FrontMatterConfig.Fields に指定できる項目の一覧です。
+var FrontMatterFields = []string{FieldSlug, FieldDescription, FieldSource, FieldPersonas, FieldSession}
+
+// FrontMatterConfig は、front matter の形式と、title・date・tags のほかに書き出す項目の設定です。
+type FrontMatterConfig struct {
+	Format FrontMatterFormat
+	// Fields は、追加で書き出す項目です。FrontMatterFields の値を指定します。
+	Fields []string
+	// Categories が空でなければ、categories として書き出します。
+	Categories []string
+	// Draft が true の場合、draft = true を書き出し、Hugo の通常のビルドで公開されないようにします。
+	Draft bool
+}
+
+// Validate は、形式と項目の名前が正しいかを確認します。
+func (c FrontMatterConfig) Validate() error {
+	switch c.Format {
+	case FrontMatterTOML, FrontMatterYAML:
+	default:
+		return fmt.Errorf("unknown front matter format '%s' (want toml or yaml)", c.Format)
+	}
+	for _, f := range c.Fields {
+		if !c.known(f) {
+			return fmt.Errorf("unknown front matter field '%s' (want one of %v)", f, FrontMatterFields)
+		}
+	}
+	return nil
+}
+
+func (c FrontMatterConfig) known(field string) bool {
+	for _, f := range FrontMatterFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (c FrontMatterConfig) has(field string) bool {
+	for _, f := range c.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// frontMatter は、Hugo の front matter の項目です。空の項目は書き出しません。
+type frontMatter struct {
+	Title       string    `toml:"title" yaml:"title"`
+	Date        time.Time `toml:"date" yaml:"date"`
+	Tags        []string  `toml:"tags" yaml:"tags"`
+	Slug        string    `toml:"slug,omitempty" yaml:"slug,omitempty"`
+	Description string    `toml:"description,omitempty" yaml:"description,omitempty"`
+	Categories  []string  `toml:"categories,omitempty" yaml:"categories,omitempty"`
+	SourceURL   string    `toml:"sourceUrl,omitempty" yaml:"sourceUrl,omitempty"`
+	Personas    []string  `toml:"personas,omitempty" yaml:"personas,omitempty"`
+	SessionID   string    `toml:"sessionId,omitempty" yaml:"sessionId,omitempty"`
+	// SourceTitle は、LLM がタイトルを書いた場合に、最初の話題の RSS のままのタイトルを残します。
+	SourceTitle string `toml:"sourceTitle,omitempty" yaml:"sourceTitle,omitempty"`
+	// Summary は、LLM が書いた要約です。Hugo は記事の一覧で、本文の冒頭の代わりにこれを使います。
+	Summary   string   `toml:"summary,omitempty" yaml:"summary,omitempty"`
+	Takeaways []string `toml:"takeaways,omitempty" yaml:"takeaways,omitempty"`
+	Draft     bool     `toml:"draft,omitempty" yaml:"draft,omitempty"`
+}
+
+// encode は、区切り線を含めた front matter を書き出します。
+// タイトルなどはエンコーダーがエスケープするため、引用符やバックスラッシュを含んでいても壊れません。
+func (fm *frontMatter) encode(format FrontMatterFormat) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case FrontMatterYAML:
+		buf.WriteString("---\n")
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(fm); err != nil {
+			return nil, fmt.Errorf("failed to encode YAML front matter: %w", err)
+		}
+		if err := enc.Close(); err != nil {
+			return nil, fmt.Errorf("failed to encode YAML front matter: %w", err)
+		}
+		buf.WriteString("---\n")
+	default:
+		buf.WriteString("+++\n")
+		if err := toml.NewEncoder(&buf).Encode(fm); err != nil {
+			return nil, fmt.Errorf("failed to encode TOML front matter: %w", err)
+		}
+		buf.WriteString("+++\n")
+	}
+	return buf.Bytes(), nil
+}
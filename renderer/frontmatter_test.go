@@ -0,0 +1,56 @@
+package renderer
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// TestFrontMatterEscaping は、引用符や改行などを含むタイトルが、front matter を壊さずに元の文字列として読み戻せることを確かめます。
+func TestFrontMatterEscaping(t *testing.T) {
+	titles := []string{
+		`A "quoted" title`,
+		`back\slash`,
+		"line\nbreak",
+		`+++ and --- inside`,
+		`key: value # not a comment`,
+		`'single' and [brackets]`,
+	}
+	for _, format := range []FrontMatterFormat{FrontMatterTOML, FrontMatterYAML} {
+		for _, title := range titles {
+			t.Run(string(format)+"/"+title, func(t *testing.T) {
+				fm := &frontMatter{Title: title, Date: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), Description: title}
+				out, err := fm.encode(format)
+				if err != nil {
+					t.Fatalf("encode: %v", err)
+				}
+
+				delim := []byte("+++\n")
+				if format == FrontMatterYAML {
+					delim = []byte("---\n")
+				}
+				body, ok := bytes.CutPrefix(out, delim)
+				if !ok || !bytes.HasSuffix(body, delim) {
+					t.Fatalf("front matter is not enclosed in %q:\n%s", delim, out)
+				}
+				body = bytes.TrimSuffix(body, delim)
+
+				var got frontMatter
+				if format == FrontMatterYAML {
+					err = yaml.Unmarshal(body, &got)
+				} else {
+					err = toml.Unmarshal(body, &got)
+				}
+				if err != nil {
+					t.Fatalf("decode: %v\n%s", err, out)
+				}
+				if got.Title != title || got.Description != title {
+					t.Errorf("got title %q and description %q, want %q", got.Title, got.Description, title)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package renderer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sat8bit/kaigi/persona"
+)
+
+// GraphConfig は、関係性の図の設定です。
+type GraphConfig struct {
+	// Embed が true の場合、記事に Mermaid の図を埋め込みます。
+	Embed bool
+	// Asset は、図を別のファイルとして書き出す形式です。"dot"、"svg" または空 (書き出さない) です。
+	// svg の書き出しには Graphviz の dot コマンドが必要です。
+	Asset string
+	// AssetDir は、Asset のファイルを書き出すディレクトリです。
+	AssetDir string
+}
+
+// Validate は、書き出す形式が正しいかを確認します。
+func (c GraphConfig) Validate() error {
+	switch c.Asset {
+	case "", "dot", "svg":
+		return nil
+	}
+	return fmt.Errorf("unknown graph asset format '%s' (want dot or svg)", c.Asset)
+}
+
+// RelationshipGraph は、参加者の間の好感度の有向グラフです。
+type RelationshipGraph struct {
+	// Nodes は、参加者です。表示名の順に並びます。
+	Nodes []*persona.Persona
+	Edges []*RelationshipEdge
+}
+
+// RelationshipEdge は、From から To への好感度です。
+type RelationshipEdge struct {
+	From, To *persona.Persona
+	Affinity int
+	// Before は、セッション開始時点の関係性です。このセッションで初めて関係を築いた場合は nil です。
+	Before *persona.Relationship
+	// Dramatic は、persona.RelationshipChange.Dramatic です。太い線で描きます。
+	Dramatic bool
+}
+
+// Label は、好感度と、このセッションでの変化を表すラベルを返します (例: "50 ▲+10")。
+func (e *RelationshipEdge) Label() string {
+	if e.Before == nil {
+		return fmt.Sprintf("%d (new)", e.Affinity)
+	}
+	switch delta := e.Affinity - e.Before.Affinity; {
+	case delta > 0:
+		return fmt.Sprintf("%d ▲+%d", e.Affinity, delta)
+	case delta < 0:
+		return fmt.Sprintf("%d ▼%d", e.Affinity, delta)
+	default:
+		return fmt.Sprintf("%d", e.Affinity)
+	}
+}
+
+// Color は、好感度に応じた辺の色を返します。
+func (e *RelationshipEdge) Color() string {
+	switch {
+	case e.Affinity >= 50:
+		return "#1a7f37"
+	case e.Affinity > 0:
+		return "#57ab5a"
+	case e.Affinity == 0:
+		return "#888888"
+	case e.Affinity > -50:
+		return "#e5534b"
+	default:
+		return "#cc0000"
+	}
+}
+
+// newRelationshipGraph は、各参加者から見た関係性からグラフを組み立てます。
+func newRelationshipGraph(perspectives []*MarkdownPerspective) *RelationshipGraph {
+	g := &RelationshipGraph{}
+	for _, p := range perspectives {
+		g.Nodes = append(g.Nodes, p.Persona)
+		for _, rel := range p.Relations {
+			g.Edges = append(g.Edges, &RelationshipEdge{
+				From:     p.Persona,
+				To:       rel.Target,
+				Affinity: rel.Affinity,
+				Before:   rel.Before,
+				Dramatic: rel.Change != nil && rel.Change.Dramatic,
+			})
+		}
+	}
+	return g
+}
+
+// Mermaid は、グラフを Mermaid の flowchart にします。コードブロックの囲みは含みません。
+// このセッションで初めて築いた関係は点線で、劇的に変わった関係は太い線で描きます。
+func (g *RelationshipGraph) Mermaid() string {
+	ids := make(map[string]string, len(g.Nodes))
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	for i, n := range g.Nodes {
+		ids[n.PersonaId] = fmt.Sprintf("p%d", i)
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[n.PersonaId], mermaidEscape(n.DisplayName))
+	}
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.Before == nil {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "  %s %s|\"%s\"| %s\n", ids[e.From.PersonaId], arrow, mermaidEscape(e.Label()), ids[e.To.PersonaId])
+	}
+	for i, e := range g.Edges {
+		width := 1
+		if e.Dramatic {
+			width = 3
+		}
+		fmt.Fprintf(&b, "  linkStyle %d stroke:%s,stroke-width:%dpx,color:%s\n", i, e.Color(), width, e.Color())
+	}
+	return b.String()
+}
+
+// DOT は、グラフを Graphviz の DOT にします。
+func (g *RelationshipGraph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph relationships {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=ellipse, fontname=\"sans-serif\"];\n")
+	b.WriteString("  edge [fontname=\"sans-serif\"];\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "  %s [label=%s];\n", dotQuote(n.PersonaId), dotQuote(n.DisplayName))
+	}
+	for _, e := range g.Edges {
+		style := "solid"
+		if e.Before == nil {
+			style = "dashed"
+		}
+		penwidth := 1
+		if e.Dramatic {
+			penwidth = 3
+		}
+		fmt.Fprintf(&b, "  %s -> %s [label=%s, color=%s, fontcolor=%s, style=%s, penwidth=%d];\n",
+			dotQuote(e.From.PersonaId), dotQuote(e.To.PersonaId), dotQuote(e.Label()), dotQuote(e.Color()), dotQuote(e.Color()), style, penwidth)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// writeAsset は、グラフを cfg.AssetDir/<name>.<形式> に書き出し、そのパスを返します。
+func (g *RelationshipGraph) writeAsset(ctx context.Context, cfg GraphConfig, name string) (string, error) {
+	content := []byte(g.DOT())
+	if cfg.Asset == "svg" {
+		cmd := exec.CommandContext(ctx, "dot", "-Tsvg")
+		cmd.Stdin = bytes.NewReader(content)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		svg, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("failed to run graphviz dot: %w: %s", err, stderr.String())
+		}
+		content = svg
+	}
+
+	if err := os.MkdirAll(cfg.AssetDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create graph directory: %w", err)
+	}
+	path := filepath.Join(cfg.AssetDir, name+"."+cfg.Asset)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return "", fmt.Errorf("failed to write graph file: %w", err)
+	}
+	return path, nil
+}
+
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
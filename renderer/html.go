@@ -0,0 +1,301 @@
+package renderer
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	buspkg "github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/session"
+	"github.com/sat8bit/kaigi/topic"
+)
+
+//go:embed html/transcript.html.tmpl
+var defaultHTMLTemplate string
+
+// HTMLTranscript は、HTML テンプレートに渡すセッションの記録です。
+// -html-template で独自のテンプレートを使う場合は、このフィールドを参照できます。
+type HTMLTranscript struct {
+	Title     string
+	SessionID string
+	StartedAt time.Time
+	Topics    []*topic.Topic
+	// Participants は、発言したペルソナです。表示名の順に並びます。
+	Participants []*HTMLParticipant
+	// Entries は、発言と途中の入退室です。会話の順に並びます。
+	Entries []*HTMLEntry
+	// Perspectives は、セッション終了時の各参加者から見た関係性です。
+	Perspectives []*HTMLPerspective
+	// Notice は、会話がエラーにより途中で終わったことを知らせる文です。-on-error note の場合にだけ設定します。
+	Notice string
+}
+
+// HTMLParticipant は、会話の参加者と、その表示用の色やアバターの文字です。
+type HTMLParticipant struct {
+	Persona *persona.Persona
+	// Hue は、ペルソナごとに決まる色相 (0〜359) です。テンプレートでは hsl() の色相として使います。
+	Hue int
+	// Initial は、アバターに表示する1文字です。
+	Initial string
+}
+
+// HTMLEntry は、会話のひとつの項目です。Speaker が nil の場合は入退室の知らせです。
+type HTMLEntry struct {
+	Anchor  string
+	Speaker *HTMLParticipant
+	Text    string
+	At      time.Time
+	// ReplyTo は、この発言が応答している発言です。
+	ReplyTo *HTMLEntry
+}
+
+// HTMLPerspective は、ある参加者から見たほかの参加者への関係性です。
+type HTMLPerspective struct {
+	Participant *HTMLParticipant
+	Relations   []*HTMLRelation
+}
+
+// HTMLRelation は、ひとりの相手に対する関係性です。
+type HTMLRelation struct {
+	Target     *HTMLParticipant
+	Affinity   int
+	Impression string
+	// Change は、このセッションでの変化です。変わらなかった場合は nil です。
+	Change *persona.RelationshipChange
+}
+
+func init() {
+	Register("html", func(o *Options) (Renderer, error) {
+		return NewHTMLRenderer(o.HTMLOutput, o.HTMLTemplate, o.DramaticSwing, o.OnError), nil
+	})
+}
+
+// NewHTMLRenderer は、セッションの記録を outputDir/<セッションID>.html に書き出すレンダラーを生成します。
+// templatePath が空の場合は、組み込みのテンプレートを使います。
+// onError は、セッションがエラーで終わった場合に、そこまでの会話をどう書き出すかです。
+func NewHTMLRenderer(outputDir, templatePath string, dramaticSwing int, onError ErrorPolicy) *HTMLRenderer {
+	return &HTMLRenderer{
+		outputDir:     outputDir,
+		templatePath:  templatePath,
+		dramaticSwing: dramaticSwing,
+		onError:       onError,
+	}
+}
+
+// HTMLRenderer は、チャットの吹き出し形式の、単体で閲覧できる HTML ファイルを書き出します。
+// 関係性も含めて一度に書き出すため、メッセージは Render で集め、Finalize で書き出します。
+type HTMLRenderer struct {
+	outputDir     string
+	templatePath  string
+	dramaticSwing int
+	onError       ErrorPolicy
+	session       *session.Session
+
+	mu       sync.Mutex
+	messages []*message.Message
+	failed   bool
+}
+
+func (r *HTMLRenderer) Render(ctx context.Context, sess *session.Session, b buspkg.Bus, wg *sync.WaitGroup) error {
+	r.session = sess
+	messageCh := b.Subscribe(
+		buspkg.WithName("html"),
+		buspkg.WithKinds(message.KindCha, message.KindError, message.KindJoin, message.KindLeave),
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for msg := range messageCh {
+			r.mu.Lock()
+			switch msg.Kind {
+			case message.KindError:
+				r.failed = true
+			case message.KindCha:
+				r.messages = append(r.messages, msg)
+			case message.KindJoin, message.KindLeave:
+				// 会話が始まる前の入室は登場人物の一覧で分かるため、途中の入退室だけを残します。
+				if len(r.messages) > 0 {
+					r.messages = append(r.messages, msg)
+				}
+			}
+			r.mu.Unlock()
+		}
+	}()
+
+	return nil
+}
+
+// Finalize は、集めた会話と関係性を HTML ファイルに書き出します。
+func (r *HTMLRenderer) Finalize(ctx context.Context, sess *session.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failed && r.onError == ErrorPolicyDiscard {
+		slog.Info("Error message detected, skipping HTML generation.")
+		return nil
+	}
+	if len(r.messages) == 0 {
+		return nil
+	}
+
+	tmpl, err := r.parseTemplate()
+	if err != nil {
+		return err
+	}
+
+	t := r.transcript(sess.Participants)
+	if r.failed && r.onError == ErrorPolicyNote {
+		t.Notice = errorNotice
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, t); err != nil {
+		return fmt.Errorf("failed to execute HTML template: %w", err)
+	}
+
+	if err := os.MkdirAll(r.outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	path := filepath.Join(r.outputDir, sess.ID+".html")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write HTML file: %w", err)
+	}
+
+	slog.Info("HTML file generated", "path", path, "partial", r.failed)
+	return nil
+}
+
+func (r *HTMLRenderer) parseTemplate() (*template.Template, error) {
+	text := defaultHTMLTemplate
+	if r.templatePath != "" {
+		b, err := os.ReadFile(r.templatePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read HTML template: %w", err)
+		}
+		text = string(b)
+	}
+
+	tmpl, err := template.New("html").Funcs(template.FuncMap{
+		"formatTime": func(t time.Time) string {
+			return t.In(session.JST()).Format("15:04:05")
+		},
+		"formatDate": func(t time.Time) string {
+			return t.In(session.JST()).Format("2006-01-02 15:04")
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// transcript は、集めたメッセージからテンプレートに渡す記録を組み立てます。
+func (r *HTMLRenderer) transcript(allPersonas []*persona.Persona) *HTMLTranscript {
+	t := &HTMLTranscript{
+		Title:     "Kaigi Log",
+		SessionID: r.session.ID,
+		StartedAt: r.session.StartedAt,
+		Topics:    r.session.Topics,
+	}
+	if len(r.session.Topics) > 0 {
+		t.Title = r.session.Topics[0].Title
+	}
+
+	participants := make(map[string]*HTMLParticipant)
+	participantOf := func(p *persona.Persona) *HTMLParticipant {
+		if hp, ok := participants[p.PersonaId]; ok {
+			return hp
+		}
+		hp := newHTMLParticipant(p)
+		participants[p.PersonaId] = hp
+		return hp
+	}
+
+	entriesByID := make(map[string]*HTMLEntry)
+	for _, msg := range r.messages {
+		entry := &HTMLEntry{Anchor: anchorID(msg), Text: msg.Text, At: msg.At}
+		if msg.Kind == message.KindCha {
+			entry.Speaker = participantOf(msg.From)
+			t.Participants = appendParticipant(t.Participants, entry.Speaker)
+			entry.ReplyTo = entriesByID[msg.ReplyTo]
+			if msg.ID != "" {
+				entriesByID[msg.ID] = entry
+			}
+		}
+		t.Entries = append(t.Entries, entry)
+	}
+	sort.Slice(t.Participants, func(i, j int) bool {
+		return t.Participants[i].Persona.DisplayName < t.Participants[j].Persona.DisplayName
+	})
+
+	personaByID := make(map[string]*persona.Persona, len(allPersonas))
+	for _, p := range allPersonas {
+		personaByID[p.PersonaId] = p
+	}
+	sorted := make([]*persona.Persona, len(allPersonas))
+	copy(sorted, allPersonas)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].DisplayName < sorted[j].DisplayName
+	})
+	for _, p := range sorted {
+		perspective := &HTMLPerspective{Participant: participantOf(p)}
+		changes := make(map[string]*persona.RelationshipChange)
+		for _, c := range p.RelationshipChanges(r.dramaticSwing) {
+			changes[c.TargetPersonaId] = c
+		}
+		for targetId, rel := range p.Relationships {
+			target, ok := personaByID[targetId]
+			if !ok {
+				continue
+			}
+			perspective.Relations = append(perspective.Relations, &HTMLRelation{
+				Target:     participantOf(target),
+				Affinity:   rel.Affinity,
+				Impression: rel.Impression,
+				Change:     changes[targetId],
+			})
+		}
+		sort.Slice(perspective.Relations, func(i, j int) bool {
+			return perspective.Relations[i].Target.Persona.DisplayName < perspective.Relations[j].Target.Persona.DisplayName
+		})
+		t.Perspectives = append(t.Perspectives, perspective)
+	}
+
+	return t
+}
+
+func appendParticipant(list []*HTMLParticipant, p *HTMLParticipant) []*HTMLParticipant {
+	for _, existing := range list {
+		if existing == p {
+			return list
+		}
+	}
+	return append(list, p)
+}
+
+func newHTMLParticipant(p *persona.Persona) *HTMLParticipant {
+	// 同じペルソナが毎回同じ色になるよう、PersonaId から色相を決めます。
+	h := fnv.New32a()
+	h.Write([]byte(p.PersonaId))
+	initial := ""
+	for _, c := range p.DisplayName {
+		initial = string(c)
+		break
+	}
+	return &HTMLParticipant{
+		Persona: p,
+		Hue:     int(h.Sum32() % 360),
+		Initial: initial,
+	}
+}
@@ -0,0 +1,67 @@
+package renderer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	buspkg "github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/session"
+)
+
+// TestHTMLRendererOnError は、エラーで終わったセッションの HTML が -on-error に従って書き出されることを確かめます。
+func TestHTMLRendererOnError(t *testing.T) {
+	tests := []struct {
+		onError    ErrorPolicy
+		wantFile   bool
+		wantNotice bool
+	}{
+		{onError: ErrorPolicyDiscard, wantFile: false},
+		{onError: ErrorPolicyDraft, wantFile: true, wantNotice: false},
+		{onError: ErrorPolicyNote, wantFile: true, wantNotice: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.onError), func(t *testing.T) {
+			dir := t.TempDir()
+			aoi := &persona.Persona{PersonaId: "aoi", DisplayName: "アオイ"}
+			sess := session.New(time.Now(), nil, nil)
+			b := buspkg.NewMemoryBus()
+			r := NewHTMLRenderer(dir, "", persona.DefaultDramaticSwing, tt.onError)
+			var wg sync.WaitGroup
+			if err := r.Render(context.Background(), sess, b, &wg); err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			b.Broadcast(&message.Message{Kind: message.KindCha, From: aoi, Text: "エラーの前の発言"})
+			b.Broadcast(&message.Message{Kind: message.KindError, From: aoi, Text: "boom"})
+			b.Close()
+			wg.Wait()
+			sess.End(time.Now(), session.EndError, []*persona.Persona{aoi}, session.Stats{})
+			if err := r.Finalize(context.Background(), sess); err != nil {
+				t.Fatalf("finalize: %v", err)
+			}
+
+			out, err := os.ReadFile(filepath.Join(dir, sess.ID+".html"))
+			if !tt.wantFile {
+				if err == nil {
+					t.Error("HTML was written for a discarded session")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("read HTML: %v", err)
+			}
+			if !strings.Contains(string(out), "エラーの前の発言") {
+				t.Error("HTML does not contain the utterance before the error")
+			}
+			if got := strings.Contains(string(out), errorNotice); got != tt.wantNotice {
+				t.Errorf("got notice %v, want %v", got, tt.wantNotice)
+			}
+		})
+	}
+}
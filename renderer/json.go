@@ -0,0 +1,204 @@
+package renderer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	buspkg "github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/session"
+	"github.com/sat8bit/kaigi/transcript"
+)
+
+func init() {
+	Register("json", func(o *Options) (Renderer, error) {
+		return NewJSONRenderer(o.JSONOutput, o.DramaticSwing), nil
+	})
+}
+
+// NewJSONRenderer は、セッションの記録を outputDir/<セッションID>.json に書き出すレンダラーを生成します。
+func NewJSONRenderer(outputDir string, dramaticSwing int) *JSONRenderer {
+	return &JSONRenderer{
+		outputDir:     outputDir,
+		dramaticSwing: dramaticSwing,
+	}
+}
+
+// JSONRenderer は、ほかのツールから読み込めるよう、セッションの記録を transcript.Transcript の形式で書き出します。
+// HTML や Markdown と違い、エラーで終わったセッションも、そこまでの記録を書き出します。
+type JSONRenderer struct {
+	outputDir     string
+	dramaticSwing int
+
+	mu       sync.Mutex
+	messages []*message.Message
+	failed   bool
+}
+
+func (r *JSONRenderer) Render(ctx context.Context, sess *session.Session, b buspkg.Bus, wg *sync.WaitGroup) error {
+	messageCh := b.Subscribe(
+		buspkg.WithName("json"),
+		buspkg.WithKinds(message.KindCha, message.KindError, message.KindJoin, message.KindLeave, message.KindEnd),
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for msg := range messageCh {
+			r.mu.Lock()
+			if msg.Kind == message.KindError {
+				r.failed = true
+			}
+			r.messages = append(r.messages, msg)
+			r.mu.Unlock()
+		}
+	}()
+
+	return nil
+}
+
+// Finalize は、集めた会話とセッション前後の関係性を JSON ファイルに書き出します。
+func (r *JSONRenderer) Finalize(ctx context.Context, sess *session.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.messages) == 0 {
+		return nil
+	}
+
+	// 発言をそのまま読めるよう、HTML の特殊文字はエスケープしません。
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r.transcript(sess)); err != nil {
+		return fmt.Errorf("failed to encode transcript: %w", err)
+	}
+
+	if err := os.MkdirAll(r.outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	path := filepath.Join(r.outputDir, sess.ID+".json")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write JSON file: %w", err)
+	}
+
+	slog.Info("JSON file generated", "path", path)
+	return nil
+}
+
+// transcript は、集めたメッセージから書き出す文書を組み立てます。
+// 終了時刻と終了の理由はセッションに記録されたものを使い、記録されていない場合はメッセージから求めます。
+func (r *JSONRenderer) transcript(sess *session.Session) *transcript.Transcript {
+	endedAt := sess.EndedAt
+	if endedAt.IsZero() {
+		endedAt = r.messages[len(r.messages)-1].At
+	}
+	t := &transcript.Transcript{
+		SchemaVersion: transcript.SchemaVersion,
+		Session: transcript.Session{
+			ID:        sess.ID,
+			StartedAt: sess.StartedAt,
+			EndedAt:   endedAt,
+			Flags:     sess.Flags,
+		},
+		Topics:       make([]*transcript.Topic, 0, len(sess.Topics)),
+		Participants: make([]*transcript.Participant, 0, len(sess.Participants)),
+		Utterances:   make([]*transcript.Utterance, 0, len(r.messages)),
+		Events:       []*transcript.Event{},
+	}
+
+	for _, tp := range sess.Topics {
+		t.Topics = append(t.Topics, &transcript.Topic{
+			Title:     tp.Title,
+			Summary:   tp.Summary,
+			SourceURL: tp.SourceURL,
+		})
+	}
+
+	sorted := make([]*persona.Persona, len(sess.Participants))
+	copy(sorted, sess.Participants)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].DisplayName < sorted[j].DisplayName
+	})
+	for _, p := range sorted {
+		t.Participants = append(t.Participants, &transcript.Participant{
+			PersonaId:           p.PersonaId,
+			DisplayName:         p.DisplayName,
+			Role:                string(p.Role),
+			Gender:              p.Gender,
+			Tagline:             p.Tagline,
+			StyleTag:            p.StyleTag,
+			Catchphrases:        p.Catchphrases,
+			RelationshipsBefore: transcriptRelationships(p.InitialRelationships),
+			RelationshipsAfter:  transcriptRelationships(p.Relationships),
+			RelationshipChanges: transcriptChanges(p.RelationshipChanges(r.dramaticSwing)),
+		})
+	}
+
+	for _, msg := range r.messages {
+		switch msg.Kind {
+		case message.KindCha:
+			t.Utterances = append(t.Utterances, &transcript.Utterance{
+				ID:      msg.ID,
+				Seq:     msg.Seq,
+				ReplyTo: msg.ReplyTo,
+				Speaker: msg.From.PersonaId,
+				Text:    msg.Text,
+				At:      msg.At,
+			})
+		case message.KindEnd:
+			t.EndReason = msg.Text
+		default:
+			e := &transcript.Event{Seq: msg.Seq, Kind: string(msg.Kind), Text: msg.Text, At: msg.At}
+			if msg.From != nil {
+				e.PersonaId = msg.From.PersonaId
+			}
+			t.Events = append(t.Events, e)
+		}
+	}
+	if sess.EndReason != "" {
+		t.EndReason = string(sess.EndReason)
+	}
+	// 終了の理由より先にエラーで途切れた場合も、エラーで終わったことが分かるようにします。
+	if t.EndReason == "" && r.failed {
+		t.EndReason = string(session.EndError)
+	}
+
+	return t
+}
+
+func transcriptRelationships(rels map[string]*persona.Relationship) []*transcript.Relationship {
+	targetIds := make([]string, 0, len(rels))
+	for id := range rels {
+		targetIds = append(targetIds, id)
+	}
+	sort.Strings(targetIds)
+
+	list := make([]*transcript.Relationship, 0, len(targetIds))
+	for _, id := range targetIds {
+		rel := rels[id]
+		list = append(list, &transcript.Relationship{
+			TargetPersonaId: id,
+			Affinity:        rel.Affinity,
+			Impression:      rel.Impression,
+		})
+	}
+	return list
+}
+
+func transcriptChanges(changes []*persona.RelationshipChange) []*transcript.RelationshipChange {
+	list := make([]*transcript.RelationshipChange, 0, len(changes))
+	for _, c := range changes {
+		list = append(list, transcript.NewRelationshipChange(c))
+	}
+	return list
+}
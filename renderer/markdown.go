@@ -2,6 +2,8 @@ package renderer
 
 import (
 	"bytes"
+	"context"
+	_ "embed"
 	"fmt"
 	"log/slog"
 	"os"
@@ -11,230 +13,491 @@ import (
 	"sync"
 	"text/template"
 	"time"
+	"unicode/utf8"
 
-	"github.com/sat8bit/kaigi/bus"
+	buspkg "github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/llm"
 	"github.com/sat8bit/kaigi/message"
 	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/session"
 	"github.com/sat8bit/kaigi/topic"
 )
 
-const markdownTemplate = `+++
-title = {{ .Title }}
-date = {{ .Date }}
-tags = {{ .Tags }}
-+++
+//go:embed markdown/post.md.tmpl
+var defaultMarkdownTemplate string
 
-{{ .Body }}
-`
+// editorialTimeout は、セッション終了後に記事のタイトルや要約を書かせるときの待ち時間の上限です。
+const editorialTimeout = time.Minute
 
-func NewMarkdownRenderer(outputDir string, topics []*topic.Topic) *MarkdownRenderer {
-	jst, err := time.LoadLocation("Asia/Tokyo")
-	if err != nil {
-		panic(fmt.Errorf("failed to load JST location: %w", err))
-	}
-	nowInJST := time.Now().In(jst)
-	slug := nowInJST.Format("20060102-150405")
-	filePath := filepath.Join(outputDir, slug+".md")
+// ErrorPolicy は、エラーで終わったセッションの記事や HTML、字幕、読み上げ台本をどう扱うかです。
+type ErrorPolicy string
 
-	return &MarkdownRenderer{
-		outputDir: outputDir,
-		topics:    topics,
-		filePath:  filePath,
+const (
+	// ErrorPolicyDiscard は、記事や HTML、字幕、読み上げ台本を書き出しません。
+	ErrorPolicyDiscard ErrorPolicy = "discard"
+	// ErrorPolicyDraft は、エラーまでの会話を Hugo の下書きとして書き出します。
+	// 下書きという状態のない HTML や字幕、読み上げ台本は、エラーまでの会話をそのまま書き出します。
+	ErrorPolicyDraft ErrorPolicy = "draft"
+	// ErrorPolicyNote は、エラーまでの会話を、途中で終わった旨の注記を付けて通常どおり書き出します。
+	// HTML では冒頭に、字幕や読み上げ台本では最後に errorNotice を加えます。
+	ErrorPolicyNote ErrorPolicy = "note"
+)
+
+// errorNotice は、ErrorPolicyNote で、HTML の冒頭や、字幕や読み上げ台本の最後に加えるお知らせです。
+const errorNotice = "この会話はエラーにより途中で終了しました。"
+
+// ParseErrorPolicy は、文字列を ErrorPolicy に変換します。
+func ParseErrorPolicy(s string) (ErrorPolicy, error) {
+	switch p := ErrorPolicy(s); p {
+	case ErrorPolicyDiscard, ErrorPolicyDraft, ErrorPolicyNote:
+		return p, nil
 	}
+	return "", fmt.Errorf("unknown error policy '%s'", s)
 }
 
-// ★★★ ログ関連のフィールドを削除 ★★★
-type MarkdownRenderer struct {
-	outputDir string
-	topics    []*topic.Topic
-	filePath  string
+// MarkdownPost は、Markdown テンプレートに渡すセッションの記録です。
+// -markdown-template で独自のテンプレートを使う場合は、このフィールドを参照できます。
+type MarkdownPost struct {
+	// FrontMatter は、区切り線を含めてエンコード済みの Hugo の front matter です。
+	FrontMatter string
+	// Title は、記事のタイトルです。LLM が書いた場合はそのタイトル、そうでなければ最初の話題のタイトルです。
+	Title string
+	// SourceTitle は、最初の話題の RSS のままのタイトルです。話題がない場合は空です。
+	SourceTitle string
+	// Excerpt は、LLM が書いた2行までの要約です。LLM を使わない場合は空です。
+	Excerpt []string
+	// Takeaways は、LLM が書いた会話の要点です。LLM を使わない場合は空です。
+	Takeaways []string
+	SessionID string
+	StartedAt time.Time
+	// EndReason は、セッションが終了した理由です。
+	EndReason session.EndReason
+	Topics    []*topic.Topic
+	// Participants は、発言したペルソナです。表示名の順に並びます。
+	Participants []*persona.Persona
+	// Entries は、発言と途中の入退室です。会話の順に並びます。
+	Entries []*MarkdownEntry
+	// Perspectives は、各参加者から見た関係性です。表示名の順に並びます。
+	Perspectives []*MarkdownPerspective
+	// Changes は、このセッションで変わった関係性です。Perspectives と同じ順に並びます。
+	Changes []*MarkdownChange
+	// Graph は、参加者の間の好感度の図です。図を埋め込まない設定の場合は nil です。
+	Graph *RelationshipGraph
+	Stats MarkdownStats
+	// Errors は、セッションを終わらせたエラーです。空でなければ、会話は途中で終わっています。
+	Errors []*MarkdownError
 }
 
-// ★★★ ログ書き出しロジックを削除 ★★★
-func (r *MarkdownRenderer) Finalize(allPersonas []*persona.Persona) error {
-	if r.filePath == "" {
-		slog.Info("Markdown file was not created, skipping epilogue.")
-		return nil
-	}
+// MarkdownError は、会話の途中で起きたエラーです。
+type MarkdownError struct {
+	// Persona は、エラーを起こした参加者です。システムのエラーでは nil です。
+	Persona *persona.Persona
+	Text    string
+	At      time.Time
+}
 
-	var contentToAppend strings.Builder
+// MarkdownEntry は、会話のひとつの項目です。Speaker が nil の場合は入退室の知らせです。
+type MarkdownEntry struct {
+	// Anchor は、発言を参照するためのアンカーのIDです。通し番号のない発言では空です。
+	Anchor  string
+	Speaker *persona.Persona
+	Text    string
+	At      time.Time
+	// ReplyTo は、この発言が応答している発言です。
+	ReplyTo *MarkdownEntry
+	// Section は、話題の切り替わりとしてこの項目の直前に入れる小見出しです。LLM が書いた場合だけ設定されます。
+	Section string
+}
 
-	contentToAppend.WriteString("\n---\n\n## 関係性\n\n")
+// MarkdownPerspective は、ある参加者から見たほかの参加者への関係性です。
+type MarkdownPerspective struct {
+	Persona *persona.Persona
+	// Relations は、相手の表示名の順に並びます。
+	Relations []*MarkdownRelation
+}
 
-	personaIdToName := make(map[string]string)
-	for _, p := range allPersonas {
-		personaIdToName[p.PersonaId] = p.DisplayName
-	}
+// MarkdownRelation は、ひとりの相手に対するセッション終了時の関係性です。
+type MarkdownRelation struct {
+	Target     *persona.Persona
+	Affinity   int
+	Impression string
+	// Before は、セッション開始時点の関係性です。このセッションで初めて関係を築いた場合は nil です。
+	Before *persona.Relationship
+	// Change は、このセッションでの変化です。変わらなかった場合は nil です。
+	Change *persona.RelationshipChange
+}
 
-	sort.Slice(allPersonas, func(i, j int) bool {
-		return allPersonas[i].DisplayName < allPersonas[j].DisplayName
-	})
+// MarkdownChange は、ある参加者からひとりの相手への関係性の、このセッションでの変化です。
+type MarkdownChange struct {
+	Persona *persona.Persona
+	Target  *persona.Persona
+	Change  *persona.RelationshipChange
+}
 
-	for _, p := range allPersonas {
-		contentToAppend.WriteString(fmt.Sprintf("### %s の視点\n", p.DisplayName))
-
-		if len(p.Relationships) == 0 {
-			contentToAppend.WriteString("- (誰とも関係を築かなかった)\n")
-		} else {
-			targetIds := make([]string, 0, len(p.Relationships))
-			for id := range p.Relationships {
-				targetIds = append(targetIds, id)
-			}
-			sort.Slice(targetIds, func(i, j int) bool {
-				return personaIdToName[targetIds[i]] < personaIdToName[targetIds[j]]
-			})
+// MarkdownStats は、会話の集計です。
+type MarkdownStats struct {
+	Utterances int
+	// Characters は、発言の文字数の合計です。
+	Characters int
+	// Duration は、最初の発言から最後の発言までの時間です。
+	Duration time.Duration
+	// Speakers は、参加者ごとの集計です。Participants と同じ順に並びます。
+	Speakers []*MarkdownSpeakerStats
+}
 
-			for _, targetId := range targetIds {
-				rel := p.Relationships[targetId]
-				targetName, ok := personaIdToName[targetId]
-				if !ok {
-					continue
-				}
-				contentToAppend.WriteString(fmt.Sprintf("- **%sに対して:** 親密度 `%d` (印象: %s)\n", targetName, rel.Affinity, rel.Impression))
-			}
-		}
-		contentToAppend.WriteString("\n")
-	}
+// MarkdownSpeakerStats は、ひとりの参加者の発言の集計です。
+type MarkdownSpeakerStats struct {
+	Persona    *persona.Persona
+	Utterances int
+	Characters int
+}
 
-	f, err := os.OpenFile(r.filePath, os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
-		if os.IsNotExist(err) {
-			slog.Warn("Markdown file does not exist, cannot append epilogue.", "path", r.filePath)
-			return nil
-		}
-		return fmt.Errorf("failed to open markdown file for appending: %w", err)
-	}
-	defer f.Close()
+func init() {
+	Register("markdown", func(o *Options) (Renderer, error) {
+		return NewMarkdownRenderer(o.OutputDir, o.MarkdownTemplate, o.FrontMatter, o.OnError, o.Graph, o.DramaticSwing, o.Editor), nil
+	})
+}
 
-	if _, err := f.WriteString(contentToAppend.String()); err != nil {
-		return fmt.Errorf("failed to append epilogue to markdown file: %w", err)
+// NewMarkdownRenderer は、セッションの記録を outputDir/<セッションID>.md に書き出すレンダラーを生成します。
+// templatePath が空の場合は、組み込みのテンプレートを使います。
+// frontMatter は、先頭に書き出す Hugo の front matter の形式と項目です。
+// onError は、セッションがエラーで終わった場合に、そこまでの会話をどう書き出すかです。
+// graph は、関係性の図を記事に埋め込むか、別のファイルに書き出すかの設定です。
+// editor が nil でなければ、書き出す前に LLM にタイトル、要約、要点と小見出しを書かせます。
+func NewMarkdownRenderer(outputDir, templatePath string, frontMatter FrontMatterConfig, onError ErrorPolicy, graph GraphConfig, dramaticSwing int, editor llm.Editor) *MarkdownRenderer {
+	return &MarkdownRenderer{
+		outputDir:     outputDir,
+		templatePath:  templatePath,
+		frontMatter:   frontMatter,
+		onError:       onError,
+		graph:         graph,
+		dramaticSwing: dramaticSwing,
+		editor:        editor,
 	}
+}
 
-	slog.Info("Epilogue appended to markdown file", "path", r.filePath)
-	return nil
+// MarkdownRenderer は、Hugo の記事として Markdown ファイルを書き出します。
+// 関係性も含めて一度に書き出すため、メッセージは Render で集め、Finalize でテンプレートに流します。
+type MarkdownRenderer struct {
+	outputDir     string
+	templatePath  string
+	frontMatter   FrontMatterConfig
+	onError       ErrorPolicy
+	graph         GraphConfig
+	dramaticSwing int
+	editor        llm.Editor
+	session       *session.Session
+
+	mu       sync.Mutex
+	messages []*message.Message
+	errors   []*message.Message
 }
 
-// ★★★ KindChaのみを収集するように変更 ★★★
-func (r *MarkdownRenderer) Render(bus bus.Bus, wg *sync.WaitGroup) error {
-	messageCh := bus.Subscribe()
-	var allMessages []*message.Message
+func (r *MarkdownRenderer) Render(ctx context.Context, sess *session.Session, b buspkg.Bus, wg *sync.WaitGroup) error {
+	r.session = sess
+	messageCh := b.Subscribe(
+		buspkg.WithName("markdown"),
+		buspkg.WithKinds(message.KindCha, message.KindError, message.KindJoin, message.KindLeave),
+	)
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		for msg := range messageCh {
-			allMessages = append(allMessages, msg)
-		}
-
-		var conversationMessages []*message.Message
-		for _, msg := range allMessages {
-			if msg.Kind == message.KindError {
-				slog.Info("Error message detected, skipping markdown generation.")
-				return
-			}
-			if msg.Kind == message.KindCha {
-				conversationMessages = append(conversationMessages, msg)
+			r.mu.Lock()
+			switch msg.Kind {
+			case message.KindError:
+				r.errors = append(r.errors, msg)
+			case message.KindCha:
+				r.messages = append(r.messages, msg)
+			case message.KindJoin, message.KindLeave:
+				// 会話が始まる前の入室は登場人物の一覧で分かるため、途中の入退室だけを残します。
+				if len(r.messages) > 0 {
+					r.messages = append(r.messages, msg)
+				}
 			}
-		}
-
-		if len(conversationMessages) == 0 {
-			return
-		}
-
-		if err := r.render(conversationMessages); err != nil {
-			slog.Error("failed to render markdown", "error", err)
+			r.mu.Unlock()
 		}
 	}()
 
 	return nil
 }
 
-// ★★★ KindChaのメッセージのみを処理するように簡略化 ★★★
-func (r *MarkdownRenderer) render(inbox []*message.Message) error {
-	jst, err := time.LoadLocation("Asia/Tokyo")
+// Finalize は、集めた会話と関係性をテンプレートに流し、Markdown ファイルを書き出します。
+func (r *MarkdownRenderer) Finalize(ctx context.Context, sess *session.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.errors) > 0 && r.onError == ErrorPolicyDiscard {
+		slog.Info("Error message detected, skipping markdown generation.")
+		return nil
+	}
+	if len(r.messages) == 0 {
+		return nil
+	}
+
+	tmpl, err := r.parseTemplate()
+	if err != nil {
+		return err
+	}
+	// ジャーナルから読み込んだセッションでは、記録されたものを使い直し、LLM は呼びません。
+	// 書かせたものはセッションに残し、後から最終処理を行うジャーナルに記録させます。
+	if sess.Editorial == nil {
+		sess.Editorial = r.editorial(ctx)
+	}
+	post, err := r.post(sess.Participants, sess.Editorial)
 	if err != nil {
-		return fmt.Errorf("failed to load JST location: %w", err)
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, post); err != nil {
+		return fmt.Errorf("failed to execute markdown template: %w", err)
+	}
+
+	if err := os.MkdirAll(r.outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	path := filepath.Join(r.outputDir, sess.ID+".md")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write markdown file: %w", err)
 	}
-	nowInJST := time.Now().In(jst)
 
-	title := "Kaigi Log"
-	if len(r.topics) > 0 {
-		title = r.topics[0].Title
+	slog.Info("Markdown file generated", "path", path, "partial", len(r.errors) > 0)
+
+	if r.graph.Asset != "" {
+		path, err := newRelationshipGraph(post.Perspectives).writeAsset(ctx, r.graph, sess.ID)
+		if err != nil {
+			return err
+		}
+		slog.Info("Relationship graph written", "path", path)
 	}
+	return nil
+}
 
-	participantsMap := make(map[string]*persona.Persona)
-	var conversationLog strings.Builder
+func (r *MarkdownRenderer) parseTemplate() (*template.Template, error) {
+	text := defaultMarkdownTemplate
+	if r.templatePath != "" {
+		b, err := os.ReadFile(r.templatePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read markdown template: %w", err)
+		}
+		text = string(b)
+	}
 
-	for _, msg := range inbox {
-		if _, ok := participantsMap[msg.From.DisplayName]; !ok {
-			participantsMap[msg.From.DisplayName] = msg.From
+	tmpl, err := template.New("markdown").Funcs(template.FuncMap{
+		"formatTime": func(t time.Time) string {
+			return t.In(session.JST()).Format("15:04:05")
+		},
+		"formatDate": func(t time.Time) string {
+			return t.In(session.JST()).Format("2006-01-02 15:04")
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse markdown template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// editorial は、集めた発言を LLM に渡し、記事のタイトル、要約、要点と小見出しを書かせます。
+// editor が設定されていない場合や、LLM の呼び出しに失敗した場合は nil を返し、記事は LLM なしで組み立てます。
+func (r *MarkdownRenderer) editorial(ctx context.Context) *session.Editorial {
+	if r.editor == nil {
+		return nil
+	}
+	input := &llm.EditorialInput{Topics: r.session.Topics}
+	for _, msg := range r.messages {
+		if msg.Kind == message.KindCha {
+			input.Messages = append(input.Messages, msg)
 		}
-		conversationLog.WriteString(fmt.Sprintf("**%s**: %s\n\n", msg.From.DisplayName, msg.Text))
 	}
 
-	var body strings.Builder
+	ctx, cancel := context.WithTimeout(ctx, editorialTimeout)
+	defer cancel()
+	e, err := r.editor.EditPost(ctx, input)
+	if err != nil {
+		slog.Warn("failed to write the post editorial, using the topic title", "error", err)
+		return nil
+	}
+	return e
+}
 
-	participantsList := make([]*persona.Persona, 0, len(participantsMap))
-	for _, p := range participantsMap {
-		participantsList = append(participantsList, p)
+// post は、集めたメッセージからテンプレートに渡す記録を組み立てます。
+// editorial が nil でなければ、そのタイトル、要約、要点と小見出しを使います。
+func (r *MarkdownRenderer) post(allPersonas []*persona.Persona, editorial *session.Editorial) (*MarkdownPost, error) {
+	p := &MarkdownPost{
+		Title:     "Kaigi Log",
+		SessionID: r.session.ID,
+		StartedAt: r.session.StartedAt,
+		EndReason: r.session.EndReason,
+		Topics:    r.session.Topics,
+	}
+	if len(r.session.Topics) > 0 {
+		p.SourceTitle = r.session.Topics[0].Title
+		p.Title = p.SourceTitle
+	}
+	sections := make(map[int]string)
+	if editorial != nil {
+		p.Title = editorial.Title
+		p.Excerpt = editorial.Excerpt
+		p.Takeaways = editorial.Takeaways
+		for _, sec := range editorial.Sections {
+			sections[sec.Index] = sec.Heading
+		}
 	}
-	sort.Slice(participantsList, func(i, j int) bool {
-		return participantsList[i].DisplayName < participantsList[j].DisplayName
-	})
 
-	body.WriteString("## 登場人物\n\n")
-	for _, p := range participantsList {
-		body.WriteString(fmt.Sprintf("- **%s:** %s\n", p.DisplayName, p.Tagline))
+	speakers := make(map[string]*MarkdownSpeakerStats)
+	entriesByID := make(map[string]*MarkdownEntry)
+	var first, last time.Time
+	for _, msg := range r.messages {
+		entry := &MarkdownEntry{Text: msg.Text, At: msg.At}
+		if msg.Kind == message.KindCha {
+			// 小見出しの位置は、発言だけを数えた番号です (session.EditorialSection を参照)。
+			entry.Section = sections[p.Stats.Utterances]
+			entry.Speaker = msg.From
+			if msg.Seq > 0 {
+				entry.Anchor = anchorID(msg)
+			}
+			entry.ReplyTo = entriesByID[msg.ReplyTo]
+			if msg.ID != "" {
+				entriesByID[msg.ID] = entry
+			}
+
+			stats, ok := speakers[msg.From.PersonaId]
+			if !ok {
+				stats = &MarkdownSpeakerStats{Persona: msg.From}
+				speakers[msg.From.PersonaId] = stats
+				p.Participants = append(p.Participants, msg.From)
+			}
+			stats.Utterances++
+			stats.Characters += utf8.RuneCountInString(msg.Text)
+			p.Stats.Utterances++
+			p.Stats.Characters += utf8.RuneCountInString(msg.Text)
+			if first.IsZero() {
+				first = msg.At
+			}
+			last = msg.At
+		}
+		p.Entries = append(p.Entries, entry)
 	}
-	body.WriteString("\n---\n\n")
+	p.Stats.Duration = last.Sub(first)
 
-	body.WriteString("## 今日の雑談\n\n")
-	body.WriteString(conversationLog.String())
+	sort.Slice(p.Participants, func(i, j int) bool {
+		return p.Participants[i].DisplayName < p.Participants[j].DisplayName
+	})
+	for _, participant := range p.Participants {
+		p.Stats.Speakers = append(p.Stats.Speakers, speakers[participant.PersonaId])
+	}
 
-	if len(r.topics) > 0 {
-		body.WriteString("---\n\n")
-		body.WriteString("## 今日の話題\n\n")
-		for _, t := range r.topics {
-			body.WriteString(fmt.Sprintf("- [%s](%s)\n", t.Title, t.SourceURL))
+	p.Perspectives = markdownPerspectives(allPersonas, r.dramaticSwing)
+	for _, perspective := range p.Perspectives {
+		for _, rel := range perspective.Relations {
+			if rel.Change != nil {
+				p.Changes = append(p.Changes, &MarkdownChange{Persona: perspective.Persona, Target: rel.Target, Change: rel.Change})
+			}
 		}
-		body.WriteString("\n")
+	}
+	if r.graph.Embed {
+		p.Graph = newRelationshipGraph(p.Perspectives)
 	}
 
-	var tags []string
-	for _, p := range participantsList {
-		tags = append(tags, fmt.Sprintf(`"%s"`, p.DisplayName))
+	for _, msg := range r.errors {
+		p.Errors = append(p.Errors, &MarkdownError{Persona: msg.From, Text: msg.Text, At: msg.At})
 	}
 
-	tmpl, err := template.New("markdown").Parse(markdownTemplate)
+	fm := r.buildFrontMatter(p.Title, r.session.StartedAt.In(session.JST()), p.Participants)
+	if editorial != nil {
+		fm.SourceTitle = p.SourceTitle
+		fm.Summary = strings.Join(p.Excerpt, "\n")
+		fm.Takeaways = p.Takeaways
+	}
+	encoded, err := fm.encode(r.frontMatter.Format)
 	if err != nil {
-		return fmt.Errorf("failed to parse markdown template: %w", err)
+		return nil, err
 	}
+	p.FrontMatter = string(encoded)
+
+	return p, nil
+}
 
-	data := struct {
-		Date  string
-		Title string
-		Tags  string
-		Body  string
-	}{
-		Date:  fmt.Sprintf(`"%s"`, nowInJST.Format("2006-01-02T15:04:05-07:00")),
-		Title: fmt.Sprintf(`"%s"`, title),
-		Tags:  fmt.Sprintf("[%s]", strings.Join(tags, ", ")),
-		Body:  body.String(),
+// markdownPerspectives は、各参加者から見た関係性を、このセッションでの変化とあわせて表示名の順に並べて返します。
+func markdownPerspectives(allPersonas []*persona.Persona, dramaticSwing int) []*MarkdownPerspective {
+	personaByID := make(map[string]*persona.Persona, len(allPersonas))
+	for _, p := range allPersonas {
+		personaByID[p.PersonaId] = p
 	}
+	sorted := make([]*persona.Persona, len(allPersonas))
+	copy(sorted, allPersonas)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].DisplayName < sorted[j].DisplayName
+	})
 
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		return fmt.Errorf("failed to execute template: %w", err)
+	perspectives := make([]*MarkdownPerspective, 0, len(sorted))
+	for _, p := range sorted {
+		perspective := &MarkdownPerspective{Persona: p}
+		changes := make(map[string]*persona.RelationshipChange)
+		for _, c := range p.RelationshipChanges(dramaticSwing) {
+			changes[c.TargetPersonaId] = c
+		}
+		for targetId, rel := range p.Relationships {
+			target, ok := personaByID[targetId]
+			if !ok {
+				continue
+			}
+			perspective.Relations = append(perspective.Relations, &MarkdownRelation{
+				Target:     target,
+				Affinity:   rel.Affinity,
+				Impression: rel.Impression,
+				Before:     p.InitialRelationships[targetId],
+				Change:     changes[targetId],
+			})
+		}
+		sort.Slice(perspective.Relations, func(i, j int) bool {
+			return perspective.Relations[i].Target.DisplayName < perspective.Relations[j].Target.DisplayName
+		})
+		perspectives = append(perspectives, perspective)
 	}
+	return perspectives
+}
 
-	if err := os.MkdirAll(r.outputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+// buildFrontMatter は、設定に従って front matter の項目を組み立てます。
+func (r *MarkdownRenderer) buildFrontMatter(title string, date time.Time, participants []*persona.Persona) *frontMatter {
+	fm := &frontMatter{
+		Title: title,
+		// 秒より細かい時刻は、投稿日時には不要なので切り捨てます。
+		Date:       date.Truncate(time.Second),
+		Tags:       make([]string, 0, len(participants)),
+		Categories: r.frontMatter.Categories,
+		// エラーで途中で終わった会話は、編集者が確認するまで公開しないようにします。
+		Draft: r.frontMatter.Draft || (len(r.errors) > 0 && r.onError == ErrorPolicyDraft),
+	}
+	for _, p := range participants {
+		fm.Tags = append(fm.Tags, p.DisplayName)
 	}
 
-	if err := os.WriteFile(r.filePath, buf.Bytes(), 0644); err != nil {
-		return fmt.Errorf("failed to write markdown file: %w", err)
+	if r.frontMatter.has(FieldSlug) {
+		fm.Slug = r.session.ID
+	}
+	if r.frontMatter.has(FieldSession) {
+		fm.SessionID = r.session.ID
 	}
+	if r.frontMatter.has(FieldPersonas) {
+		for _, p := range participants {
+			fm.Personas = append(fm.Personas, p.PersonaId)
+		}
+	}
+	if len(r.session.Topics) > 0 {
+		if r.frontMatter.has(FieldDescription) {
+			fm.Description = r.session.Topics[0].Summary
+		}
+		if r.frontMatter.has(FieldSource) {
+			fm.SourceURL = r.session.Topics[0].SourceURL
+		}
+	}
+	return fm
+}
 
-	slog.Info("Markdown file generated", "path", r.filePath)
-	return nil
+// anchorID は、発言を参照するためのアンカーのIDを返します。
+func anchorID(msg *message.Message) string {
+	return fmt.Sprintf("m-%d", msg.Seq)
 }
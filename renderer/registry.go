@@ -0,0 +1,107 @@
+package renderer
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sat8bit/kaigi/llm"
+)
+
+// Options は、レンダラーの生成に使う設定です。各レンダラーは、必要な項目だけを参照します。
+type Options struct {
+	// OutputDir は、markdown レンダラーが記事を書き出すディレクトリです。
+	OutputDir        string
+	MarkdownTemplate string
+	FrontMatter      FrontMatterConfig
+	OnError          ErrorPolicy
+	Graph            GraphConfig
+	Console          ConsoleConfig
+	// DramaticSwing は、persona.Persona.RelationshipChanges に渡す dramaticSwing です。
+	DramaticSwing int
+	// WebAddr は、web レンダラーが待ち受けるアドレスです。空の場合、web レンダラーは使えません。
+	WebAddr        string
+	HTMLOutput     string
+	HTMLTemplate   string
+	JSONOutput     string
+	SubtitleOutput string
+	Subtitle       SubtitleConfig
+	VoiceOutput    string
+	// Emotions は、voice レンダラーが発言の感情を判定するのに使います。nil の場合は判定しません。
+	Emotions llm.EmotionAnalyzer
+	// Editor は、markdown レンダラーが記事のタイトル、要約、要点と小見出しを書かせるのに使います。nil の場合は書かせません。
+	Editor llm.Editor
+}
+
+// Factory は、設定からレンダラーを生成する関数です。
+type Factory func(opts *Options) (Renderer, error)
+
+// ErrUnavailable は、この実行ではレンダラーを使えないことを表します。
+// Factory がこのエラーを返した場合、Build はそのレンダラーを飛ばして続けます。
+var ErrUnavailable = errors.New("renderer is not available")
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]Factory)
+)
+
+// Register は、-renderers で指定する名前でレンダラーを登録します。
+// 各レンダラーのファイルの init から呼び出します。同じ名前を二度登録すると panic します。
+func Register(name string, f Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("renderer '%s' is already registered", name))
+	}
+	registry[name] = f
+}
+
+// Names は、登録されているレンダラーの名前を、名前の順に返します。
+func Names() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Build は、カンマ区切りの名前の一覧から、指定された順にレンダラーを生成します。
+// 未知の名前と ErrUnavailable を返したレンダラーは、警告を残して飛ばします。
+// そのほかの生成の失敗は、すべてのレンダラーを試したうえで、まとめて返します。
+func Build(names string, opts *Options) ([]Renderer, error) {
+	var renderers []Renderer
+	var errs []error
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		registryMu.Lock()
+		f, ok := registry[name]
+		registryMu.Unlock()
+		if !ok {
+			slog.Warn("Unknown renderer specified, skipping.", "name", name, "available", Names())
+			continue
+		}
+
+		slog.Info("Building renderer...", "name", name)
+		r, err := f(opts)
+		if errors.Is(err, ErrUnavailable) {
+			slog.Warn("Renderer is not available here, skipping.", "name", name, "reason", err)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to build renderer '%s': %w", name, err))
+			continue
+		}
+		renderers = append(renderers, r)
+	}
+	return renderers, errors.Join(errs...)
+}
@@ -1,18 +1,23 @@
 package renderer
 
 import (
+	"context"
 	"sync"
 
 	"github.com/sat8bit/kaigi/bus"
-	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/session"
 )
 
 // Renderer は、会話のレンダリングを行うコンポーネントが満たすべきインターフェースです。
+// セッションの情報は、コンストラクタではなく Render と Finalize に渡される session.Session から参照します。
 type Renderer interface {
 	// Render は、会話のメインループ中のレンダリング処理を開始します。
-	Render(bus bus.Bus, wg *sync.WaitGroup) error
+	// バスの購読はバスが閉じられるまで続け、その終了を wg で知らせます。
+	// ctx が取り消された場合は、サーバーなど、レンダラーが起動したバックグラウンドの処理を止めます。
+	Render(ctx context.Context, sess *session.Session, bus bus.Bus, wg *sync.WaitGroup) error
 
 	// Finalize は、すべての会話が終了した後の最終処理を行います。
-	// 例えば、ファイルの末尾にフッターを追記するなどの処理を想定しています。
-	Finalize(allPersonas []*persona.Persona) error
+	// sess には、終了時刻、終了の理由、参加者と集計が設定されています。
+	// ctx が取り消された場合は、LLM の呼び出しなど時間のかかる処理を打ち切ります。
+	Finalize(ctx context.Context, sess *session.Session) error
 }
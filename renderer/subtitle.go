@@ -0,0 +1,297 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	buspkg "github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/session"
+)
+
+// SubtitleTiming は、字幕の表示時間の決め方です。
+type SubtitleTiming string
+
+const (
+	// SubtitleTimingAt は、発言の時刻 (message.Message.At) から、次の発言までを表示時間とします。
+	SubtitleTimingAt SubtitleTiming = "at"
+	// SubtitleTimingCPS は、1秒あたりに読める文字数から表示時間を決め、発言を詰めて並べます。
+	SubtitleTimingCPS SubtitleTiming = "cps"
+)
+
+// ParseSubtitleTiming は、文字列を SubtitleTiming に変換します。
+func ParseSubtitleTiming(s string) (SubtitleTiming, error) {
+	switch t := SubtitleTiming(s); t {
+	case SubtitleTimingAt, SubtitleTimingCPS:
+		return t, nil
+	}
+	return "", fmt.Errorf("unknown subtitle timing '%s'", s)
+}
+
+const (
+	// minCueDuration は、ひとつの字幕を表示する最短の時間です。
+	minCueDuration = time.Second
+	// cueGap は、SubtitleTimingCPS で発言と発言の間に空ける時間です。
+	cueGap = 200 * time.Millisecond
+)
+
+// SubtitleConfig は、字幕の表示時間と改行の設定です。
+type SubtitleConfig struct {
+	Timing SubtitleTiming
+	// CharsPerSecond は、1秒あたりに読める文字数です。SubtitleTimingCPS の表示時間に使います。
+	CharsPerSecond float64
+	// LineWidth は、1行の最大の文字数です。話者名も含みます。
+	LineWidth int
+	// MaxLines は、ひとつの字幕に表示する最大の行数です。収まらない発言は複数の字幕に分けます。
+	MaxLines int
+}
+
+// subtitleCue は、ひとつの字幕です。
+type subtitleCue struct {
+	start, end time.Duration
+	speaker    string
+	lines      []string
+}
+
+func init() {
+	Register("subtitles", func(o *Options) (Renderer, error) {
+		return NewSubtitleRenderer(o.SubtitleOutput, o.Subtitle, o.OnError), nil
+	})
+}
+
+// NewSubtitleRenderer は、発言を outputDir/<セッションID>.srt と .vtt の字幕に書き出すレンダラーを生成します。
+// onError は、セッションがエラーで終わった場合に、そこまでの発言をどう書き出すかです。
+func NewSubtitleRenderer(outputDir string, cfg SubtitleConfig, onError ErrorPolicy) *SubtitleRenderer {
+	return &SubtitleRenderer{
+		outputDir: outputDir,
+		cfg:       cfg,
+		onError:   onError,
+	}
+}
+
+// SubtitleRenderer は、動画の編集ソフトに読み込める SRT と WebVTT の字幕を書き出します。
+// 表示時間を決めるには発言の全体が必要なため、メッセージは Render で集め、Finalize で書き出します。
+type SubtitleRenderer struct {
+	outputDir string
+	cfg       SubtitleConfig
+	onError   ErrorPolicy
+
+	mu       sync.Mutex
+	messages []*message.Message
+	failed   bool
+}
+
+func (r *SubtitleRenderer) Render(ctx context.Context, sess *session.Session, b buspkg.Bus, wg *sync.WaitGroup) error {
+	messageCh := b.Subscribe(
+		buspkg.WithName("subtitle"),
+		buspkg.WithKinds(message.KindCha, message.KindError),
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for msg := range messageCh {
+			r.mu.Lock()
+			if msg.Kind == message.KindError {
+				r.failed = true
+			} else {
+				r.messages = append(r.messages, msg)
+			}
+			r.mu.Unlock()
+		}
+	}()
+
+	return nil
+}
+
+// Finalize は、集めた発言から字幕を組み立て、SRT と WebVTT のファイルを書き出します。
+func (r *SubtitleRenderer) Finalize(ctx context.Context, sess *session.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failed && r.onError == ErrorPolicyDiscard {
+		slog.Info("Error message detected, skipping subtitle generation.")
+		return nil
+	}
+	if len(r.messages) == 0 {
+		return nil
+	}
+
+	cues := r.cues()
+	if r.failed && r.onError == ErrorPolicyNote {
+		// お知らせは話者のない字幕として、最後の発言の後に表示します。
+		start := cues[len(cues)-1].end + cueGap
+		cues = append(cues, &subtitleCue{
+			start: start,
+			end:   start + r.readingTime(errorNotice),
+			lines: wrapJapanese(errorNotice, r.cfg.LineWidth),
+		})
+	}
+
+	if err := os.MkdirAll(r.outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	for ext, content := range map[string]string{".srt": formatSRT(cues), ".vtt": formatWebVTT(cues)} {
+		path := filepath.Join(r.outputDir, sess.ID+ext)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write subtitle file: %w", err)
+		}
+		slog.Info("Subtitle file generated", "path", path, "partial", r.failed)
+	}
+	return nil
+}
+
+// cues は、発言ごとの表示時間を決め、行数に収まるよう字幕に分けます。
+func (r *SubtitleRenderer) cues() []*subtitleCue {
+	var cues []*subtitleCue
+	var next time.Duration
+	origin := r.messages[0].At
+
+	for i, msg := range r.messages {
+		reading := r.readingTime(msg.Text)
+
+		var start, end time.Duration
+		switch r.cfg.Timing {
+		case SubtitleTimingAt:
+			start = msg.At.Sub(origin)
+			end = start + reading
+			if i+1 < len(r.messages) {
+				end = r.messages[i+1].At.Sub(origin)
+			}
+		default:
+			start = next
+			end = start + reading
+			next = end + cueGap
+		}
+		if end <= start {
+			end = start + minCueDuration
+		}
+
+		// 話者名は最初の行の先頭に付けるため、折り返しの幅に含めます。
+		label := msg.From.DisplayName + "："
+		lines := wrapJapanese(label+msg.Text, r.cfg.LineWidth)
+		chunks := chunkLines(lines, r.cfg.MaxLines)
+
+		// ひとつの発言を複数の字幕に分ける場合は、文字数に応じて表示時間を分けます。
+		total := utf8.RuneCountInString(label + msg.Text)
+		elapsed := 0
+		for j, chunk := range chunks {
+			n := 0
+			for _, l := range chunk {
+				n += utf8.RuneCountInString(l)
+			}
+			cue := &subtitleCue{
+				start:   start + (end-start)*time.Duration(elapsed)/time.Duration(total),
+				speaker: msg.From.DisplayName,
+				lines:   chunk,
+			}
+			elapsed += n
+			cue.end = start + (end-start)*time.Duration(elapsed)/time.Duration(total)
+			if j == len(chunks)-1 {
+				cue.end = end
+			}
+			cues = append(cues, cue)
+		}
+	}
+	return cues
+}
+
+// readingTime は、文字数と読む速さから、発言を読み終えるまでの時間を返します。
+func (r *SubtitleRenderer) readingTime(text string) time.Duration {
+	d := time.Duration(float64(utf8.RuneCountInString(text)) / r.cfg.CharsPerSecond * float64(time.Second))
+	if d < minCueDuration {
+		return minCueDuration
+	}
+	return d
+}
+
+func formatSRT(cues []*subtitleCue) string {
+	var b strings.Builder
+	for i, c := range cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, subtitleTimestamp(c.start, ","), subtitleTimestamp(c.end, ","), strings.Join(c.lines, "\n"))
+	}
+	return b.String()
+}
+
+// formatWebVTT は、WebVTT の字幕を書き出します。話者は声のタグ (<v>) でも示し、プレーヤーが話者ごとに表示を変えられるようにします。
+// 話者のないお知らせには、声のタグを付けません。
+func formatWebVTT(cues []*subtitleCue) string {
+	escaper := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for i, c := range cues {
+		lines := make([]string, len(c.lines))
+		for j, l := range c.lines {
+			lines[j] = escaper.Replace(l)
+		}
+		voice := ""
+		if c.speaker != "" {
+			voice = "<v " + escaper.Replace(c.speaker) + ">"
+		}
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s%s\n\n", i+1, subtitleTimestamp(c.start, "."), subtitleTimestamp(c.end, "."), voice, strings.Join(lines, "\n"))
+	}
+	return b.String()
+}
+
+// subtitleTimestamp は、時間を hh:mm:ss<sep>mmm の形式にします。SRT の区切りは ","、WebVTT は "." です。
+func subtitleTimestamp(d time.Duration, sep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// 行頭に置かない文字 (行頭禁則) と、その直後で改行したい文字です。
+const (
+	noLineStart = "、。，．・：；？！ー～）」』】〕〉》’”ぁぃぅぇぉっゃゅょゎァィゥェォッャュョヮ!?)]}.,:;"
+	breakAfter  = "、。！？!?…　 "
+)
+
+// wrapJapanese は、日本語の文章を1行 width 文字以内に折り返します。
+// 句読点の直後で改行し、句読点や小書きの仮名が行頭に来る場合は、前の行にぶら下げます。
+func wrapJapanese(text string, width int) []string {
+	runes := []rune(strings.TrimSpace(text))
+	if width <= 0 || len(runes) <= width {
+		return []string{string(runes)}
+	}
+
+	var lines []string
+	for len(runes) > width {
+		cut := width
+		// 行の後半に句読点があれば、その直後で改行します。
+		for i := width; i > width/2; i-- {
+			if strings.ContainsRune(breakAfter, runes[i-1]) {
+				cut = i
+				break
+			}
+		}
+		// 行頭禁則の文字は、1文字までならはみ出しても前の行に含めます。
+		if cut < len(runes) && strings.ContainsRune(noLineStart, runes[cut]) {
+			cut++
+		}
+		lines = append(lines, strings.TrimSpace(string(runes[:cut])))
+		runes = []rune(strings.TrimSpace(string(runes[cut:])))
+	}
+	if len(runes) > 0 {
+		lines = append(lines, string(runes))
+	}
+	return lines
+}
+
+// chunkLines は、行を maxLines 行ずつに分けます。
+func chunkLines(lines []string, maxLines int) [][]string {
+	if maxLines <= 0 {
+		return [][]string{lines}
+	}
+	var chunks [][]string
+	for len(lines) > maxLines {
+		chunks = append(chunks, lines[:maxLines])
+		lines = lines[maxLines:]
+	}
+	return append(chunks, lines)
+}
@@ -0,0 +1,30 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWrapJapanese(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		width int
+		want  []string
+	}{
+		{name: "fits", text: "短い発言", width: 16, want: []string{"短い発言"}},
+		{name: "no limit", text: "あいうえおかきくけこ", width: 0, want: []string{"あいうえおかきくけこ"}},
+		{name: "hard cut", text: "あいうえおかきくけこ", width: 4, want: []string{"あいうえ", "おかきく", "けこ"}},
+		{name: "break after punctuation", text: "あいうえおかきくけこ、さしすせそたちつてと", width: 12, want: []string{"あいうえおかきくけこ、", "さしすせそたちつてと"}},
+		{name: "no line start", text: "あいうえお。かきく", width: 5, want: []string{"あいうえお。", "かきく"}},
+		{name: "trims spaces", text: " あいうえお かきく ", width: 6, want: []string{"あいうえお", "かきく"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := wrapJapanese(tt.text, tt.width)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
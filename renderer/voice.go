@@ -0,0 +1,232 @@
+package renderer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	buspkg "github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/llm"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/session"
+)
+
+// emotionTimeout は、セッション終了後に発言の感情を判定するときの待ち時間の上限です。
+const emotionTimeout = time.Minute
+
+// emotionProsody は、感情の強さが 1 のときに、話す速さの倍率と声の高さ (半音) に加える量です。
+var emotionProsody = map[string]struct{ rate, pitch float64 }{
+	llm.EmotionJoy:      {rate: 0.10, pitch: 2},
+	llm.EmotionSadness:  {rate: -0.15, pitch: -2},
+	llm.EmotionAnger:    {rate: 0.05, pitch: 1},
+	llm.EmotionSurprise: {rate: 0.05, pitch: 3},
+	llm.EmotionFear:     {rate: 0.10, pitch: 1},
+}
+
+// voiceLine は、読み上げ台本のひとつの発言です。JSON Lines の1行として書き出します。
+// エラーで終わったお知らせの行は、Seq が 0 で Speaker が空です。
+type voiceLine struct {
+	Seq     uint64 `json:"seq"`
+	Speaker string `json:"speaker"`
+	// Voice は、音声合成エンジンの声の名前です。ペルソナに設定がなければ空です。
+	Voice  string  `json:"voice,omitempty"`
+	Gender string  `json:"gender,omitempty"`
+	Rate   float64 `json:"rate"`
+	Pitch  float64 `json:"pitch"`
+	// Emotion と Intensity は、-voice-emotion で感情を判定した場合だけ入ります。
+	Emotion   string  `json:"emotion,omitempty"`
+	Intensity float64 `json:"intensity,omitempty"`
+	Text      string  `json:"text"`
+}
+
+func init() {
+	Register("voice", func(o *Options) (Renderer, error) {
+		return NewVoiceRenderer(o.VoiceOutput, o.Emotions, o.OnError), nil
+	})
+}
+
+// NewVoiceRenderer は、読み上げ台本を outputDir/<セッションID>.ssml と .voice.jsonl に書き出すレンダラーを生成します。
+// emotions が nil でなければ、発言ごとの感情を判定して、話す速さと声の高さに反映します。
+// onError は、セッションがエラーで終わった場合に、そこまでの発言をどう書き出すかです。
+func NewVoiceRenderer(outputDir string, emotions llm.EmotionAnalyzer, onError ErrorPolicy) *VoiceRenderer {
+	return &VoiceRenderer{
+		outputDir: outputDir,
+		emotions:  emotions,
+		onError:   onError,
+	}
+}
+
+// VoiceRenderer は、音声合成エンジンに渡す SSML と、発言ごとの JSON の台本を書き出します。
+// 声はペルソナの voice の設定から選びます。
+type VoiceRenderer struct {
+	outputDir string
+	emotions  llm.EmotionAnalyzer
+	onError   ErrorPolicy
+
+	mu       sync.Mutex
+	messages []*message.Message
+	failed   bool
+}
+
+func (r *VoiceRenderer) Render(ctx context.Context, sess *session.Session, b buspkg.Bus, wg *sync.WaitGroup) error {
+	messageCh := b.Subscribe(
+		buspkg.WithName("voice"),
+		buspkg.WithKinds(message.KindCha, message.KindError),
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for msg := range messageCh {
+			r.mu.Lock()
+			if msg.Kind == message.KindError {
+				r.failed = true
+			} else {
+				r.messages = append(r.messages, msg)
+			}
+			r.mu.Unlock()
+		}
+	}()
+
+	return nil
+}
+
+// Finalize は、集めた発言から台本を組み立て、SSML と JSON Lines のファイルを書き出します。
+func (r *VoiceRenderer) Finalize(ctx context.Context, sess *session.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failed && r.onError == ErrorPolicyDiscard {
+		slog.Info("Error message detected, skipping voice script generation.")
+		return nil
+	}
+	if len(r.messages) == 0 {
+		return nil
+	}
+
+	lines := r.lines(ctx)
+	if r.failed && r.onError == ErrorPolicyNote {
+		// お知らせは、エンジンの既定の声で最後に読み上げます。
+		lines = append(lines, &voiceLine{Rate: 1, Text: errorNotice})
+	}
+
+	ssml, err := formatSSML(lines)
+	if err != nil {
+		return err
+	}
+	var jsonl bytes.Buffer
+	enc := json.NewEncoder(&jsonl)
+	enc.SetEscapeHTML(false)
+	for _, l := range lines {
+		if err := enc.Encode(l); err != nil {
+			return fmt.Errorf("failed to encode voice line: %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(r.outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	for name, content := range map[string][]byte{sess.ID + ".ssml": ssml, sess.ID + ".voice.jsonl": jsonl.Bytes()} {
+		path := filepath.Join(r.outputDir, name)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			return fmt.Errorf("failed to write voice script: %w", err)
+		}
+		slog.Info("Voice script generated", "path", path, "partial", r.failed)
+	}
+	return nil
+}
+
+// lines は、発言ごとに声と抑揚を決めます。
+// 感情の判定は ctx に従い、emotionTimeout を超えた場合は抑揚の指定なしで台本を書き出します。
+func (r *VoiceRenderer) lines(ctx context.Context) []*voiceLine {
+	var emotions []*llm.Emotion
+	if r.emotions != nil {
+		ctx, cancel := context.WithTimeout(ctx, emotionTimeout)
+		defer cancel()
+		var err error
+		emotions, err = r.emotions.AnalyzeEmotions(ctx, &llm.EmotionInput{Messages: r.messages})
+		if err != nil {
+			slog.Warn("failed to analyze emotions, writing the script without prosody hints", "error", err)
+			emotions = nil
+		}
+	}
+
+	lines := make([]*voiceLine, 0, len(r.messages))
+	for i, msg := range r.messages {
+		v := msg.From.Voice
+		l := &voiceLine{
+			Seq:     msg.Seq,
+			Speaker: msg.From.PersonaId,
+			Voice:   v.Name,
+			Gender:  msg.From.Gender,
+			Rate:    v.Rate,
+			Pitch:   v.Pitch,
+			Text:    msg.Text,
+		}
+		if l.Rate == 0 {
+			l.Rate = 1
+		}
+		if i < len(emotions) {
+			e := emotions[i]
+			l.Emotion, l.Intensity = e.Label, e.Intensity
+			if p, ok := emotionProsody[e.Label]; ok {
+				l.Rate += p.rate * e.Intensity
+				l.Pitch += p.pitch * e.Intensity
+			}
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+// formatSSML は、発言を SSML 1.1 の文書にします。発言の間には短い間を置きます。
+// 声の名前も性別も決まっていない発言は、属性のない <voice> が SSML の誤りになるため、<voice> で囲まずにエンジンの既定の声に任せます。
+func formatSSML(lines []*voiceLine) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<speak version="1.1" xmlns="http://www.w3.org/2001/10/synthesis" xml:lang="ja-JP">` + "\n")
+	for _, l := range lines {
+		b.WriteString("  ")
+		voice := true
+		switch {
+		case l.Voice != "":
+			b.WriteString("<voice")
+			writeXMLAttr(&b, "name", l.Voice)
+			b.WriteString(">")
+		case l.Gender == "female" || l.Gender == "male":
+			b.WriteString("<voice")
+			writeXMLAttr(&b, "gender", l.Gender)
+			b.WriteString(">")
+		default:
+			voice = false
+		}
+		b.WriteString("<prosody")
+		writeXMLAttr(&b, "rate", fmt.Sprintf("%.0f%%", l.Rate*100))
+		writeXMLAttr(&b, "pitch", fmt.Sprintf("%+.1fst", l.Pitch))
+		b.WriteString(">")
+		if err := xml.EscapeText(&b, []byte(l.Text)); err != nil {
+			return nil, fmt.Errorf("failed to escape SSML text: %w", err)
+		}
+		b.WriteString("</prosody>")
+		if voice {
+			b.WriteString("</voice>")
+		}
+		b.WriteString("\n")
+		b.WriteString(`  <break time="500ms"/>` + "\n")
+	}
+	b.WriteString("</speak>\n")
+	return b.Bytes(), nil
+}
+
+func writeXMLAttr(b *bytes.Buffer, name, value string) {
+	b.WriteString(" " + name + `="`)
+	xml.EscapeText(b, []byte(value))
+	b.WriteString(`"`)
+}
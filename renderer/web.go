@@ -0,0 +1,279 @@
+package renderer
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	buspkg "github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/session"
+)
+
+//go:embed web/index.html
+var webIndexHTML []byte
+
+// webEvent は、ブラウザに Server-Sent Events として送るイベントです。
+type webEvent struct {
+	ID           string           `json:"id,omitempty"`
+	Seq          uint64           `json:"seq,omitempty"`
+	Kind         message.Kind     `json:"kind"`
+	From         *webPersona      `json:"from,omitempty"`
+	Text         string           `json:"text,omitempty"`
+	At           time.Time        `json:"at"`
+	ReplyTo      string           `json:"replyTo,omitempty"`
+	Relationship *webRelationship `json:"relationship,omitempty"`
+}
+
+type webPersona struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type webRelationship struct {
+	Target     *webPersona `json:"target"`
+	Affinity   int         `json:"affinity"`
+	Impression string      `json:"impression"`
+}
+
+// WebRenderer は、会話をブラウザにライブ配信する HTTP サーバーです。
+// 埋め込みの Web ページを配信し、バスのメッセージを Server-Sent Events で送ります。
+// 途中から接続したブラウザにも、それまでのイベントをすべて送ります。
+// 履歴に残すイベントには <セッションID>/<番号> の id を付け、再接続したブラウザには Last-Event-ID の続きから送ります。
+type WebRenderer struct {
+	addr    string
+	session *session.Session
+	server  *http.Server
+
+	mu      sync.Mutex
+	history [][]byte
+	clients map[chan []byte]struct{}
+	names   map[string]string
+	done    chan struct{}
+}
+
+func init() {
+	Register("web", func(o *Options) (Renderer, error) {
+		if o.WebAddr == "" {
+			return nil, fmt.Errorf("%w: -web-addr is empty", ErrUnavailable)
+		}
+		return NewWebRenderer(o.WebAddr), nil
+	})
+}
+
+// NewWebRenderer は、addr で待ち受ける WebRenderer を生成します。
+func NewWebRenderer(addr string) *WebRenderer {
+	return &WebRenderer{
+		addr:    addr,
+		clients: make(map[chan []byte]struct{}),
+		names:   make(map[string]string),
+		done:    make(chan struct{}),
+	}
+}
+
+func (r *WebRenderer) Render(ctx context.Context, sess *session.Session, b buspkg.Bus, wg *sync.WaitGroup) error {
+	r.session = sess
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", r.handleIndex)
+	mux.HandleFunc("/events", r.handleEvents)
+	// ポートが使われているなどで待ち受けられない場合は、セッションを始める前にエラーにします。
+	l, err := net.Listen("tcp", r.addr)
+	if err != nil {
+		return fmt.Errorf("failed to start web viewer: %w", err)
+	}
+	// ポートに 0 を指定された場合に備え、実際に待ち受けているアドレスを控えます。
+	r.addr = l.Addr().String()
+	r.server = &http.Server{
+		Handler:     mux,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		if err := r.server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("web renderer stopped", "error", err)
+		}
+	}()
+	slog.Info("Web viewer started", "addr", r.addr)
+
+	messageCh := b.Subscribe(
+		buspkg.WithName("web"),
+		buspkg.WithKinds(
+			message.KindSystem, message.KindCha, message.KindError, message.KindEnd,
+			message.KindJoin, message.KindLeave, message.KindTyping, message.KindRelationship,
+		),
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for msg := range messageCh {
+			r.publish(r.toEvent(msg))
+		}
+	}()
+
+	return nil
+}
+
+// Finalize は、ブラウザにセッションの終了を知らせ、サーバーを停止します。
+func (r *WebRenderer) Finalize(ctx context.Context, sess *session.Session) error {
+	if r.server == nil {
+		return nil
+	}
+	r.publishFrame([]byte("event: close\ndata: {}\n\n"), true)
+	close(r.done)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := r.server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shut down web viewer: %w", err)
+	}
+	return nil
+}
+
+func (r *WebRenderer) toEvent(msg *message.Message) *webEvent {
+	e := &webEvent{
+		ID:      msg.ID,
+		Seq:     msg.Seq,
+		Kind:    msg.Kind,
+		Text:    msg.Text,
+		At:      msg.At,
+		ReplyTo: msg.ReplyTo,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if msg.From != nil {
+		r.names[msg.From.PersonaId] = msg.From.DisplayName
+		e.From = &webPersona{ID: msg.From.PersonaId, Name: msg.From.DisplayName}
+	}
+	if rel := msg.Relationship; rel != nil {
+		e.Relationship = &webRelationship{
+			Target:     &webPersona{ID: rel.TargetPersonaId, Name: r.names[rel.TargetPersonaId]},
+			Affinity:   rel.Affinity,
+			Impression: rel.Impression,
+		}
+	}
+	return e
+}
+
+// publish は、イベントを接続中のすべてのブラウザに送ります。
+func (r *WebRenderer) publish(e *webEvent) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("failed to marshal web event", "error", err)
+		return
+	}
+	// 入力中の表示は一時的なものなので、履歴には残しません。
+	r.publishFrame([]byte(fmt.Sprintf("data: %s\n\n", data)), e.Kind != message.KindTyping)
+}
+
+// publishFrame は、SSE のフレームを送ります。keep が true の場合は、id を付けて、後から接続したブラウザ用に履歴に残します。
+func (r *WebRenderer) publishFrame(frame []byte, keep bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if keep {
+		frame = append([]byte(fmt.Sprintf("id: %s/%d\n", r.session.ID, len(r.history)+1)), frame...)
+		r.history = append(r.history, frame)
+	}
+	for ch := range r.clients {
+		select {
+		case ch <- frame:
+		default:
+			// 受信が追いつかないブラウザは切断します。EventSource が再接続し、Last-Event-ID の続きから履歴で追いつきます。
+			delete(r.clients, ch)
+			close(ch)
+		}
+	}
+}
+
+func (r *WebRenderer) handleIndex(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		http.NotFound(w, req)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(webIndexHTML)
+}
+
+// resumeFrom は、再接続したブラウザが最後に受け取ったイベントの id から、履歴のどこから送り直すかを返します。
+// 別のセッションの id や読めない id であれば、初めから送ります。r.mu を取った状態で呼び出します。
+func (r *WebRenderer) resumeFrom(lastEventID string) int {
+	n, ok := strings.CutPrefix(lastEventID, r.session.ID+"/")
+	if !ok {
+		return 0
+	}
+	i, err := strconv.Atoi(n)
+	if err != nil || i < 0 || i > len(r.history) {
+		return 0
+	}
+	return i
+}
+
+func (r *WebRenderer) handleEvents(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ch := make(chan []byte, 64)
+	r.mu.Lock()
+	history := r.history[r.resumeFrom(req.Header.Get("Last-Event-ID")):]
+	r.clients[ch] = struct{}{}
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.clients, ch)
+		r.mu.Unlock()
+	}()
+
+	fmt.Fprintf(w, "event: session\ndata: {\"id\":%q}\n\n", r.session.ID)
+	for _, frame := range history {
+		w.Write(frame)
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case frame, ok := <-ch:
+			if !ok {
+				// 受信が追いつかず、publishFrame が切断しました。
+				return
+			}
+			w.Write(frame)
+			flusher.Flush()
+		case <-r.done:
+			// 終了の通知を取りこぼさないよう、届いているイベントを送りきってから閉じます。
+			for {
+				select {
+				case frame, ok := <-ch:
+					if !ok {
+						flusher.Flush()
+						return
+					}
+					w.Write(frame)
+				default:
+					flusher.Flush()
+					return
+				}
+			}
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
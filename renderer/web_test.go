@@ -0,0 +1,140 @@
+package renderer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	buspkg "github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/session"
+)
+
+// startWebRenderer は、空いているポートで WebRenderer を起動し、texts を KindSystem として流します。
+func startWebRenderer(t *testing.T, texts ...string) (*WebRenderer, *session.Session) {
+	t.Helper()
+	b := buspkg.NewMemoryBus()
+	sess := session.New(time.Now(), nil, nil)
+	r := NewWebRenderer("127.0.0.1:0")
+	var wg sync.WaitGroup
+	if err := r.Render(context.Background(), sess, b, &wg); err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	t.Cleanup(func() {
+		b.Close()
+		wg.Wait()
+		r.Finalize(context.Background(), sess)
+	})
+
+	for _, text := range texts {
+		b.Broadcast(&message.Message{Kind: message.KindSystem, Text: text})
+	}
+	// 購読者がメッセージを履歴に積み終えるのを待ちます。
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		n := len(r.history)
+		r.mu.Unlock()
+		if n == len(texts) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return r, sess
+}
+
+// readEventIDs は、/events に接続し、最初に届いた n 個のイベントの id を返します。
+func readEventIDs(t *testing.T, r *WebRenderer, lastEventID string, n int) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+r.addr+"/events", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get events: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(ids) < n && scanner.Scan() {
+		if id, ok := strings.CutPrefix(scanner.Text(), "id: "); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func TestWebRendererResumesFromLastEventID(t *testing.T) {
+	r, sess := startWebRenderer(t, "a", "b", "c")
+	id := func(n string) string { return sess.ID + "/" + n }
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		want        []string
+	}{
+		{name: "first connection", lastEventID: "", want: []string{id("1"), id("2"), id("3")}},
+		{name: "reconnection", lastEventID: id("2"), want: []string{id("3")}},
+		{name: "other session", lastEventID: "other/2", want: []string{id("1"), id("2"), id("3")}},
+		{name: "unreadable id", lastEventID: id("x"), want: []string{id("1"), id("2"), id("3")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readEventIDs(t, r, tt.lastEventID, len(tt.want))
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got ids %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebRendererDisconnectsSlowClient(t *testing.T) {
+	r, _ := startWebRenderer(t)
+
+	slow := make(chan []byte, 1)
+	r.mu.Lock()
+	r.clients[slow] = struct{}{}
+	r.mu.Unlock()
+
+	r.publishFrame([]byte("data: {}\n\n"), true)
+	r.publishFrame([]byte("data: {}\n\n"), true)
+
+	r.mu.Lock()
+	_, connected := r.clients[slow]
+	r.mu.Unlock()
+	if connected {
+		t.Error("slow client is still connected")
+	}
+	<-slow
+	if _, ok := <-slow; ok {
+		t.Error("slow client's channel is not closed")
+	}
+}
+
+func TestWebRendererPortInUse(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+
+	b := buspkg.NewMemoryBus()
+	defer b.Close()
+	var wg sync.WaitGroup
+	r := NewWebRenderer(l.Addr().String())
+	if err := r.Render(context.Background(), session.New(time.Now(), nil, nil), b, &wg); err == nil {
+		t.Error("Render succeeded on a port in use")
+	}
+}
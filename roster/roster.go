@@ -0,0 +1,150 @@
+package roster
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/persona"
+)
+
+// Participant は、会話に参加するコンポーネント（Cha や Human）が満たすインターフェースです。
+type Participant interface {
+	Start()
+	End()
+}
+
+// Factory は、ペルソナから会話の参加者を生成します。
+type Factory func(p *persona.Persona) Participant
+
+// Roster は、セッション中の参加者の入退室を管理します。
+// 入室・退室は KindJoin / KindLeave のメッセージとしてバスに通知されるため、
+// Supervisor やレンダラーはバスを購読するだけで参加者の変化を知ることができます。
+type Roster struct {
+	bus     bus.Bus
+	store   *persona.RelationshipStore
+	factory Factory
+
+	mu     sync.Mutex
+	active map[string]Participant
+	// 一度でも参加したペルソナ（参加順）。関係性の保存や Finalize に使います。
+	all []*persona.Persona
+}
+
+// NewRoster は新しい Roster を生成します。
+func NewRoster(bus bus.Bus, store *persona.RelationshipStore, factory Factory) *Roster {
+	return &Roster{
+		bus:     bus,
+		store:   store,
+		factory: factory,
+		active:  make(map[string]Participant),
+	}
+}
+
+// Join は、factory で生成した参加者としてペルソナを会話に参加させます。
+func (r *Roster) Join(p *persona.Persona) error {
+	return r.JoinWith(p, r.factory(p))
+}
+
+// JoinWith は、指定された参加者としてペルソナを会話に参加させます。
+// 初めて参加するペルソナの場合は、関係性データを読み込みます。
+func (r *Roster) JoinWith(p *persona.Persona, participant Participant) error {
+	r.mu.Lock()
+	if _, ok := r.active[p.PersonaId]; ok {
+		r.mu.Unlock()
+		return fmt.Errorf("persona '%s' has already joined", p.PersonaId)
+	}
+	if !r.hasJoinedBefore(p.PersonaId) {
+		if err := r.store.LoadForPersona(p); err != nil {
+			slog.Error("failed to load relationship for persona", "personaId", p.PersonaId, "error", err)
+		}
+		r.all = append(r.all, p)
+	}
+	r.active[p.PersonaId] = participant
+	r.mu.Unlock()
+
+	participant.Start()
+	slog.Info("Participant joined", "personaId", p.PersonaId, "displayName", p.DisplayName)
+
+	return r.bus.Broadcast(&message.Message{
+		From: p,
+		Text: fmt.Sprintf("%s が参加しました。", p.DisplayName),
+		At:   time.Now(),
+		Kind: message.KindJoin,
+	})
+}
+
+// Leave は、ペルソナを会話から退室させます。
+func (r *Roster) Leave(personaId string) error {
+	r.mu.Lock()
+	participant, ok := r.active[personaId]
+	if !ok {
+		r.mu.Unlock()
+		return fmt.Errorf("persona '%s' is not in the conversation", personaId)
+	}
+	delete(r.active, personaId)
+	p := r.find(personaId)
+	r.mu.Unlock()
+
+	participant.End()
+	slog.Info("Participant left", "personaId", p.PersonaId, "displayName", p.DisplayName)
+
+	return r.bus.Broadcast(&message.Message{
+		From: p,
+		Text: fmt.Sprintf("%s が退室しました。", p.DisplayName),
+		At:   time.Now(),
+		Kind: message.KindLeave,
+	})
+}
+
+// LeaveAll は、現在参加しているすべての参加者を、退室を通知して退室させます。
+// 会話を続けるほかのプロセスがあるセッションから、このプロセスの参加者だけが抜けるときに使います。
+func (r *Roster) LeaveAll() {
+	r.mu.Lock()
+	personaIds := make([]string, 0, len(r.active))
+	for id := range r.active {
+		personaIds = append(personaIds, id)
+	}
+	r.mu.Unlock()
+
+	for _, id := range personaIds {
+		if err := r.Leave(id); err != nil {
+			slog.Error("failed to leave", "personaId", id, "error", err)
+		}
+	}
+}
+
+// EndAll は、現在参加しているすべての参加者を停止します。
+// セッション終了時の処理なので、退室の通知は行いません。
+func (r *Roster) EndAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, participant := range r.active {
+		participant.End()
+	}
+}
+
+// Personas は、セッション中に一度でも参加したすべてのペルソナを参加順に返します。
+func (r *Roster) Personas() []*persona.Persona {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	personas := make([]*persona.Persona, len(r.all))
+	copy(personas, r.all)
+	return personas
+}
+
+func (r *Roster) hasJoinedBefore(personaId string) bool {
+	return r.find(personaId) != nil
+}
+
+func (r *Roster) find(personaId string) *persona.Persona {
+	for _, p := range r.all {
+		if p.PersonaId == personaId {
+			return p
+		}
+	}
+	return nil
+}
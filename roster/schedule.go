@@ -0,0 +1,152 @@
+package roster
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/persona"
+)
+
+// Action は、スケジュールされた入退室の種類です。
+type Action string
+
+const (
+	ActionJoin  Action = "join"
+	ActionLeave Action = "leave"
+)
+
+// Event は、ひとつの入退室の予定です。
+// AtTurn が正の場合はそのターン数に達した時点で、OnMention が true の場合は
+// 会話の中でペルソナの表示名が呼ばれた時点で実行されます。
+type Event struct {
+	Action    Action
+	PersonaId string
+	AtTurn    int
+	OnMention bool
+}
+
+// ParseSchedule は、"join:sou@10,leave:gou@15,join:ren@mention" のような形式の
+// 文字列を解析して、入退室の予定のスライスを返します。
+func ParseSchedule(s string) ([]*Event, error) {
+	var events []*Event
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		actionAndId, trigger, ok := strings.Cut(entry, "@")
+		if !ok {
+			return nil, fmt.Errorf("invalid schedule entry '%s': missing '@<turn>' or '@mention'", entry)
+		}
+		action, personaId, ok := strings.Cut(actionAndId, ":")
+		if !ok || personaId == "" {
+			return nil, fmt.Errorf("invalid schedule entry '%s': expected '<join|leave>:<personaId>'", entry)
+		}
+
+		event := &Event{Action: Action(action), PersonaId: personaId}
+		switch event.Action {
+		case ActionJoin, ActionLeave:
+		default:
+			return nil, fmt.Errorf("invalid schedule entry '%s': unknown action '%s'", entry, action)
+		}
+
+		if trigger == "mention" {
+			if event.Action != ActionJoin {
+				return nil, fmt.Errorf("invalid schedule entry '%s': only join can be triggered by a mention", entry)
+			}
+			event.OnMention = true
+		} else {
+			turn, err := strconv.Atoi(trigger)
+			if err != nil || turn <= 0 {
+				return nil, fmt.Errorf("invalid schedule entry '%s': turn must be a positive integer", entry)
+			}
+			event.AtTurn = turn
+		}
+
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Scheduler は、バスを監視し、予定された入退室を Roster に対して実行します。
+type Scheduler struct {
+	roster *Roster
+	pool   *persona.Pool
+	bus    bus.Bus
+	events []*Event
+}
+
+// NewScheduler は新しい Scheduler を生成します。
+func NewScheduler(roster *Roster, pool *persona.Pool, bus bus.Bus, events []*Event) *Scheduler {
+	return &Scheduler{
+		roster: roster,
+		pool:   pool,
+		bus:    bus,
+		events: events,
+	}
+}
+
+// Start は、バスの監視を開始します。
+func (s *Scheduler) Start() {
+	if len(s.events) == 0 {
+		return
+	}
+	messageCh := s.bus.Subscribe(bus.WithName("scheduler"), bus.WithKinds(message.KindCha))
+
+	go func() {
+		pending := s.events
+		currentTurn := 0
+		for msg := range messageCh {
+			if len(pending) == 0 {
+				continue
+			}
+			currentTurn++
+
+			var remaining []*Event
+			for _, e := range pending {
+				if s.isDue(e, msg, currentTurn) {
+					s.execute(e)
+				} else {
+					remaining = append(remaining, e)
+				}
+			}
+			pending = remaining
+		}
+	}()
+}
+
+func (s *Scheduler) isDue(e *Event, msg *message.Message, currentTurn int) bool {
+	if e.AtTurn > 0 {
+		return currentTurn >= e.AtTurn
+	}
+	if !e.OnMention || msg.From == nil || msg.From.PersonaId == e.PersonaId {
+		return false
+	}
+	p, err := s.pool.GetByPersonaId(e.PersonaId)
+	if err != nil {
+		return false
+	}
+	return strings.Contains(msg.Text, p.DisplayName)
+}
+
+func (s *Scheduler) execute(e *Event) {
+	var err error
+	switch e.Action {
+	case ActionJoin:
+		var p *persona.Persona
+		p, err = s.pool.GetByPersonaId(e.PersonaId)
+		if err == nil {
+			err = s.roster.Join(p)
+		}
+	case ActionLeave:
+		err = s.roster.Leave(e.PersonaId)
+	}
+	if err != nil {
+		slog.Warn("failed to execute scheduled event", "action", e.Action, "personaId", e.PersonaId, "error", err)
+	}
+}
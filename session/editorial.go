@@ -0,0 +1,19 @@
+package session
+
+// Editorial は、LLM が書いた記事のタイトル、要約、要点と小見出しです。
+type Editorial struct {
+	Title string
+	// Excerpt は、記事の一覧に載せる要約です。1行ずつ、2行までです。
+	Excerpt []string
+	// Takeaways は、会話の要点です。
+	Takeaways []string
+	// Sections は、話題の切り替わりに入れる小見出しです。Index の順に並びます。
+	Sections []*EditorialSection
+}
+
+// EditorialSection は、会話の途中に入れる小見出しです。
+type EditorialSection struct {
+	// Index は、発言 (message.KindCha) だけを会話の順に数えた、0 始まりの番号です。小見出しはこの発言の直前に入れます。
+	Index   int
+	Heading string
+}
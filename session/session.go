@@ -0,0 +1,100 @@
+package session
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/topic"
+)
+
+// idLayout は、セッションIDの書式です。Markdown の出力ファイル名と同じ形式です。
+const idLayout = "20060102-150405"
+
+// Session は、ひとつの会話セッションのメタデータです。
+// 開始時に分かる項目は New で、終了時に分かる項目は End で設定します。
+type Session struct {
+	// ID は、セッションを一意に識別する文字列です。開始時刻 (JST) から作られます。
+	ID        string
+	StartedAt time.Time
+	// EndedAt は、セッションが終了した時刻です。終了するまではゼロ値です。
+	EndedAt time.Time
+	Topics  []*topic.Topic
+	// Participants は、途中参加も含めて、セッションに参加したペルソナです。終了するまでは空です。
+	Participants []*persona.Persona
+	// Flags は、セッションを実行したときのコマンドラインフラグの値です。
+	Flags map[string]string
+	// EndReason は、セッションが終了した理由です。終了するまでは空です。
+	EndReason EndReason
+	// Stats は、発言の集計です。終了時に設定されます。
+	Stats Stats
+	// Editorial は、LLM が書いた記事のタイトルや要約です。markdown レンダラーが Finalize で書かせた場合と、
+	// ジャーナルから読み込んだ場合に設定されます。ジャーナルは、これを終了時の記録に残します。
+	Editorial *Editorial
+}
+
+// Stats は、セッションの発言の集計です。
+type Stats struct {
+	Utterances int
+	// Characters は、発言の文字数の合計です。
+	Characters int
+	// BySpeaker は、PersonaId ごとの発言の数です。
+	BySpeaker map[string]int
+}
+
+// Count は、ひとつの発言を集計に加えます。
+func (s *Stats) Count(personaId, text string) {
+	if s.BySpeaker == nil {
+		s.BySpeaker = make(map[string]int)
+	}
+	s.Utterances++
+	s.Characters += utf8.RuneCountInString(text)
+	s.BySpeaker[personaId]++
+}
+
+// EndReason は、セッションが終了した理由です。終了時に KindEnd のメッセージの Text として流れます。
+type EndReason string
+
+const (
+	// EndMaxTurns は、最大ターン数に達して終了したことを表します。
+	EndMaxTurns EndReason = "max_turns"
+	// EndError は、参加者のエラーで終了したことを表します。
+	EndError EndReason = "error"
+	// EndAllLeft は、参加者が全員退室して終了したことを表します。
+	EndAllLeft EndReason = "all_left"
+	// EndInterrupted は、シグナルなどで外から中断されたことを表します。
+	EndInterrupted EndReason = "interrupted"
+)
+
+// New は、startedAt に開始したセッションを生成します。
+func New(startedAt time.Time, topics []*topic.Topic, flags map[string]string) *Session {
+	return &Session{
+		ID:        NewID(startedAt),
+		StartedAt: startedAt,
+		Topics:    topics,
+		Flags:     flags,
+	}
+}
+
+// End は、セッションの終了時刻、終了の理由、参加者と集計を設定します。レンダラーの Finalize より前に呼び出します。
+func (s *Session) End(endedAt time.Time, reason EndReason, participants []*persona.Persona, stats Stats) {
+	s.EndedAt = endedAt
+	s.EndReason = reason
+	s.Participants = participants
+	s.Stats = stats
+}
+
+// NewID は、時刻からセッションIDを作ります。
+func NewID(t time.Time) string {
+	return t.In(JST()).Format(idLayout)
+}
+
+// JST は、日本標準時のロケーションを返します。
+func JST() *time.Location {
+	jst, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		panic(fmt.Errorf("failed to load JST location: %w", err))
+	}
+	return jst
+}
@@ -3,52 +3,160 @@ package supervisor
 import (
 	"context"
 	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/sat8bit/kaigi/bus"
 	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/session"
 )
 
 func NewSupervisor(maxTurns int, bus bus.Bus, cancel context.CancelFunc) *Supervisor {
 	return &Supervisor{
-		maxTurns: maxTurns,
-		bus:      bus, // ★ 追加
-		cancel:   cancel,
+		maxTurns:     maxTurns,
+		bus:          bus, // ★ 追加
+		cancel:       cancel,
+		participants: make(map[string]*persona.Persona),
 	}
 }
 
+// NewGuestSupervisor は、別のプロセスの Supervisor が終了させるセッションに加わるための Supervisor を生成します。
+// ターンと発言は数えますが、自分では終了を判断せず、バスに流れた KindEnd を受け取って cancel を呼び出します。
+func NewGuestSupervisor(maxTurns int, bus bus.Bus, cancel context.CancelFunc) *Supervisor {
+	s := NewSupervisor(maxTurns, bus, cancel)
+	s.guest = true
+	return s
+}
+
 type Supervisor struct {
-	maxTurns    int
+	maxTurns int
+	bus      bus.Bus // ★ 追加
+	cancel   context.CancelFunc
+	// guest は、NewGuestSupervisor で生成された場合に true です。
+	guest bool
+
+	// mu は、以下のフィールドを守ります。GetCurrentTurn などは、ほかのゴルーチンから呼び出されます。
+	mu          sync.Mutex
 	currentTurn int
-	bus         bus.Bus // ★ 追加
-	cancel      context.CancelFunc
+	// 現在会話に参加しているペルソナ。KindJoin / KindLeave から組み立てます。
+	participants map[string]*persona.Persona
+	stats        session.Stats
+	endReason    session.EndReason
 }
 
 func (s *Supervisor) Start() {
-	messageCh := s.bus.Subscribe()
+	messageCh := s.bus.Subscribe(
+		bus.WithName("supervisor"),
+		bus.WithKinds(message.KindError, message.KindCha, message.KindJoin, message.KindLeave, message.KindEnd),
+	)
 
 	go func() {
+		// シャットダウンを指示した後も、バスが閉じられるまでメッセージを読み捨てます。
+		shuttingDown := false
 		for msg := range messageCh {
+			if shuttingDown {
+				continue
+			}
+			if s.guest {
+				shuttingDown = s.follow(msg)
+				continue
+			}
 			switch msg.Kind {
 			case message.KindError: // ★ 追加
 				slog.Error("Error message received, shutting down.", "from", msg.From.DisplayName, "error", msg.Text)
-				s.cancel()
-				return
+				s.end(session.EndError)
+				shuttingDown = true
 			case message.KindCha:
-				s.currentTurn++
-				if s.currentTurn >= s.maxTurns {
+				if s.countTurn(msg) >= s.maxTurns {
 					slog.Info("Max turns reached, shutting down.")
-					s.cancel()
-					return
+					s.end(session.EndMaxTurns)
+					shuttingDown = true
+				}
+			case message.KindJoin:
+				s.mu.Lock()
+				s.participants[msg.From.PersonaId] = msg.From
+				s.mu.Unlock()
+			case message.KindLeave:
+				s.mu.Lock()
+				delete(s.participants, msg.From.PersonaId)
+				remaining := len(s.participants)
+				s.mu.Unlock()
+				if remaining == 0 {
+					slog.Info("All participants have left, shutting down.")
+					s.end(session.EndAllLeft)
+					shuttingDown = true
 				}
 			}
 		}
 	}()
 }
 
+// follow は、ゲストとしてメッセージを処理します。KindEnd を受け取ったら、その理由でセッションを終了させて true を返します。
+func (s *Supervisor) follow(msg *message.Message) bool {
+	switch msg.Kind {
+	case message.KindCha:
+		s.countTurn(msg)
+	case message.KindEnd:
+		slog.Info("Session ended by the host, shutting down.", "reason", msg.Text)
+		s.mu.Lock()
+		s.endReason = session.EndReason(msg.Text)
+		s.mu.Unlock()
+		s.cancel()
+		return true
+	}
+	return false
+}
+
+// countTurn は、発言を集計してターンを進め、進めた後のターン数を返します。
+func (s *Supervisor) countTurn(msg *message.Message) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Count(msg.From.PersonaId, msg.Text)
+	s.currentTurn++
+	return s.currentTurn
+}
+
+// end は、終了の理由を KindEnd としてバスに流し、セッションを終了させます。
+func (s *Supervisor) end(reason session.EndReason) {
+	s.mu.Lock()
+	s.endReason = reason
+	s.mu.Unlock()
+	if err := s.bus.Broadcast(&message.Message{
+		Text: string(reason),
+		At:   time.Now(),
+		Kind: message.KindEnd,
+	}); err != nil {
+		slog.Error("failed to broadcast end message", "reason", reason, "error", err)
+	}
+	s.cancel()
+}
+
 func (s *Supervisor) GetCurrentTurn() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.currentTurn
 }
 
 func (s *Supervisor) GetMaxTurns() int {
 	return s.maxTurns
 }
+
+// EndReason は、Supervisor がセッションを終了させた理由を返します。まだ終了させていない場合は空です。
+func (s *Supervisor) EndReason() session.EndReason {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.endReason
+}
+
+// Stats は、これまでの発言の集計を返します。
+func (s *Supervisor) Stats() session.Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.BySpeaker = make(map[string]int, len(s.stats.BySpeaker))
+	for id, n := range s.stats.BySpeaker {
+		stats.BySpeaker[id] = n
+	}
+	return stats
+}
@@ -0,0 +1,51 @@
+package supervisor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/message"
+	"github.com/sat8bit/kaigi/persona"
+	"github.com/sat8bit/kaigi/session"
+)
+
+// TestSupervisorMaxTurns は、発言を数えながら別のゴルーチンからターン数を読んでも競合せず、
+// 上限に達したところでセッションを終了させることを確かめます。-race を付けて実行してください。
+func TestSupervisorMaxTurns(t *testing.T) {
+	b := bus.NewMemoryBus()
+	defer b.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewSupervisor(5, b, cancel)
+	s.Start()
+
+	aoi := &persona.Persona{PersonaId: "aoi"}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ctx.Err() == nil {
+			if turn := s.GetCurrentTurn(); turn > s.GetMaxTurns() {
+				t.Errorf("got turn %d beyond the max", turn)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		b.Broadcast(&message.Message{Kind: message.KindCha, From: aoi, Text: "こんにちは"})
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("session did not end at the max turns")
+	}
+	<-done
+	if got := s.EndReason(); got != session.EndMaxTurns {
+		t.Errorf("got end reason %q, want %q", got, session.EndMaxTurns)
+	}
+	if got := s.Stats().BySpeaker["aoi"]; got != 5 {
+		t.Errorf("got %d utterances from aoi, want 5", got)
+	}
+}
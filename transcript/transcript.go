@@ -0,0 +1,147 @@
+// Package transcript は、セッションの記録を構造化した JSON 文書の形式を定義します。
+// json レンダラーが書き出すファイルを、ほかのツールから読み込むときに使います。
+package transcript
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sat8bit/kaigi/persona"
+)
+
+// SchemaVersion は、文書の形式のバージョンです。
+// フィールドの追加では変えず、既存のフィールドの意味や形を変えるときに上げます。
+const SchemaVersion = 1
+
+// Transcript は、ひとつのセッションの記録です。
+type Transcript struct {
+	SchemaVersion int      `json:"schemaVersion"`
+	Session       Session  `json:"session"`
+	Topics        []*Topic `json:"topics"`
+	// Participants は、セッションに現れたペルソナです。表示名の順に並びます。
+	Participants []*Participant `json:"participants"`
+	// Utterances は、発言です。会話の順 (Seq の昇順) に並びます。
+	Utterances []*Utterance `json:"utterances"`
+	// Events は、入退室やエラーなど、発言以外の出来事です。会話の順に並びます。
+	Events []*Event `json:"events"`
+	// EndReason は、セッションが終了した理由です。session.EndReason の値が入ります。
+	// 終了の理由が流れる前に途切れたセッションでは空です。
+	EndReason string `json:"endReason,omitempty"`
+}
+
+// Session は、セッションのメタデータです。
+type Session struct {
+	ID        string    `json:"id"`
+	StartedAt time.Time `json:"startedAt"`
+	// EndedAt は、セッションの終了時刻です。終了時刻が記録されていない場合は、最後のメッセージの時刻です。
+	EndedAt time.Time `json:"endedAt"`
+	// Flags は、セッションを実行したときのコマンドラインフラグの値です。
+	Flags map[string]string `json:"flags,omitempty"`
+}
+
+// Topic は、セッションの話題です。
+type Topic struct {
+	Title     string `json:"title"`
+	Summary   string `json:"summary"`
+	SourceURL string `json:"sourceUrl"`
+}
+
+// Participant は、ペルソナの定義と、セッションの前後の関係性です。
+type Participant struct {
+	PersonaId    string   `json:"personaId"`
+	DisplayName  string   `json:"displayName"`
+	Role         string   `json:"role,omitempty"`
+	Gender       string   `json:"gender"`
+	Tagline      string   `json:"tagline"`
+	StyleTag     string   `json:"styleTag"`
+	Catchphrases []string `json:"catchphrases,omitempty"`
+	// RelationshipsBefore は、セッション開始時点の関係性です。相手の PersonaId の順に並びます。
+	RelationshipsBefore []*Relationship `json:"relationshipsBefore"`
+	// RelationshipsAfter は、セッション終了時点の関係性です。相手の PersonaId の順に並びます。
+	RelationshipsAfter []*Relationship `json:"relationshipsAfter"`
+	// RelationshipChanges は、このセッションで変わった関係性です。相手の PersonaId の順に並びます。
+	RelationshipChanges []*RelationshipChange `json:"relationshipChanges"`
+}
+
+// Relationship は、ひとりの相手に対する関係性です。
+type Relationship struct {
+	TargetPersonaId string `json:"targetPersonaId"`
+	Affinity        int    `json:"affinity"`
+	Impression      string `json:"impression"`
+}
+
+// RelationshipChange は、ひとりの相手に対する関係性の、セッションの前後での変化です。
+type RelationshipChange struct {
+	TargetPersonaId  string `json:"targetPersonaId"`
+	AffinityBefore   int    `json:"affinityBefore"`
+	AffinityAfter    int    `json:"affinityAfter"`
+	AffinityDelta    int    `json:"affinityDelta"`
+	ImpressionBefore string `json:"impressionBefore"`
+	ImpressionAfter  string `json:"impressionAfter"`
+	// New は、このセッションで初めて関係を築いた場合に true です。
+	New bool `json:"new,omitempty"`
+	// Dramatic は、-dramatic-swing の基準で劇的な変化だった場合に true です。
+	Dramatic bool `json:"dramatic,omitempty"`
+}
+
+// NewRelationshipChange は、persona.RelationshipChange から RelationshipChange を作ります。
+func NewRelationshipChange(c *persona.RelationshipChange) *RelationshipChange {
+	return &RelationshipChange{
+		TargetPersonaId:  c.TargetPersonaId,
+		AffinityBefore:   c.AffinityBefore(),
+		AffinityAfter:    c.After.Affinity,
+		AffinityDelta:    c.AffinityDelta,
+		ImpressionBefore: c.ImpressionBefore(),
+		ImpressionAfter:  c.After.Impression,
+		New:              c.Before == nil,
+		Dramatic:         c.Dramatic,
+	}
+}
+
+// Utterance は、ひとつの発言です。
+type Utterance struct {
+	ID  string `json:"id"`
+	Seq uint64 `json:"seq"`
+	// ReplyTo は、この発言が応答している発言の ID です。応答先がなければ空です。
+	ReplyTo string `json:"replyTo,omitempty"`
+	// Speaker は、発言したペルソナの PersonaId です。
+	Speaker string    `json:"speaker"`
+	Text    string    `json:"text"`
+	At      time.Time `json:"at"`
+}
+
+// Event は、発言以外の出来事です。
+type Event struct {
+	Seq  uint64 `json:"seq"`
+	Kind string `json:"kind"`
+	// PersonaId は、出来事に関わったペルソナです。システムからの出来事では空です。
+	PersonaId string    `json:"personaId,omitempty"`
+	Text      string    `json:"text"`
+	At        time.Time `json:"at"`
+}
+
+// Read は、r から文書を読み込みます。
+// 対応していない新しいバージョンの文書の場合はエラーを返します。
+func Read(r io.Reader) (*Transcript, error) {
+	var t Transcript
+	if err := json.NewDecoder(r).Decode(&t); err != nil {
+		return nil, fmt.Errorf("failed to decode transcript: %w", err)
+	}
+	if t.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("transcript has schema version %d, but only up to %d is supported", t.SchemaVersion, SchemaVersion)
+	}
+	return &t, nil
+}
+
+// ReadFile は、path の文書を読み込みます。
+func ReadFile(path string) (*Transcript, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open transcript %s: %w", path, err)
+	}
+	defer f.Close()
+	return Read(f)
+}
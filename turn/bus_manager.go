@@ -0,0 +1,120 @@
+package turn
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sat8bit/kaigi/bus"
+	"github.com/sat8bit/kaigi/message"
+)
+
+// BusManager は、バスを通してターンを割り当てる turn.Manager の実装です。
+// ターンの要求と解放を KindTurnRequest と KindTurnRelease としてバスに流し、要求がバスに流れた順にターンを渡します。
+// ハブにつながったすべてのプロセスが同じ順番でメッセージを受け取るため、別々のプロセスの参加者の間でも、
+// ターンを持つのは常にひとりです。
+// ターンを持ったままプロセスが落ちた場合、そのターンは解放されません。
+type BusManager struct {
+	bus bus.Bus
+
+	mu sync.Mutex
+	// queue は、解放されていない要求の ID です。バスに流れた順に並び、先頭の要求がターンを持ちます。
+	queue []string
+	// waiting は、このプロセスの要求のうち、ターンが回ってくるのを待っているものです。回ってきたら閉じます。
+	waiting map[string]chan struct{}
+	// held は、このプロセスが持っているターンの要求の ID です。
+	held string
+}
+
+// NewBusManager は、b を通してターンを割り当てる BusManager を生成します。
+// セッションのほかのプロセスも、同じハブにつながった BusManager を使う必要があります。
+func NewBusManager(b bus.Bus) Manager {
+	m := &BusManager{
+		bus:     b,
+		waiting: make(map[string]chan struct{}),
+	}
+	messageCh := b.Subscribe(
+		bus.WithName("turn"),
+		bus.WithKinds(message.KindTurnRequest, message.KindTurnRelease),
+	)
+	go m.run(messageCh)
+	return m
+}
+
+// run は、バスに流れた要求と解放から順番待ちの列を組み立て、先頭になった要求にターンを渡します。
+func (m *BusManager) run(messageCh <-chan *message.Message) {
+	for msg := range messageCh {
+		m.mu.Lock()
+		switch msg.Kind {
+		case message.KindTurnRequest:
+			m.queue = append(m.queue, msg.ID)
+		case message.KindTurnRelease:
+			for i, id := range m.queue {
+				if id == msg.ReplyTo {
+					m.queue = append(m.queue[:i], m.queue[i+1:]...)
+					break
+				}
+			}
+		}
+		if len(m.queue) > 0 {
+			if granted, ok := m.waiting[m.queue[0]]; ok {
+				close(granted)
+				delete(m.waiting, m.queue[0])
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// Acquire はターンを要求し、順番が回ってくるまでブロックします。
+// ctx がキャンセルされた場合は、要求を取り下げてエラーを返します。
+func (m *BusManager) Acquire(ctx context.Context) error {
+	id := message.NewID()
+	granted := make(chan struct{})
+	m.mu.Lock()
+	m.waiting[id] = granted
+	m.mu.Unlock()
+
+	if err := m.bus.Broadcast(&message.Message{ID: id, At: time.Now(), Kind: message.KindTurnRequest}); err != nil {
+		m.mu.Lock()
+		delete(m.waiting, id)
+		m.mu.Unlock()
+		return fmt.Errorf("failed to request turn: %w", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		m.mu.Lock()
+		delete(m.waiting, id)
+		m.mu.Unlock()
+		// 順番が回ってきていた場合も、取り下げと同じく解放すればよいです。
+		m.release(id)
+		return fmt.Errorf("failed to acquire turn: %w", ctx.Err())
+	case <-granted:
+		m.mu.Lock()
+		m.held = id
+		m.mu.Unlock()
+		return nil
+	}
+}
+
+// Release は保持しているターンを解放します。保持していない場合は何もしません。
+func (m *BusManager) Release() {
+	m.mu.Lock()
+	id := m.held
+	m.held = ""
+	m.mu.Unlock()
+	if id != "" {
+		m.release(id)
+	}
+}
+
+// release は、要求 id の解放をバスに流します。
+func (m *BusManager) release(id string) {
+	// セッションの終了でバスが閉じられた後は、解放を待つ相手もいないため、失敗しても構いません。
+	m.bus.Broadcast(&message.Message{ReplyTo: id, At: time.Now(), Kind: message.KindTurnRelease})
+}
+
+// コンパイル時に Manager インターフェースを実装していることを保証します。
+var _ Manager = (*BusManager)(nil)
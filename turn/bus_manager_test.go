@@ -0,0 +1,79 @@
+package turn
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sat8bit/kaigi/bus"
+)
+
+// TestBusManagerMutualExclusion は、同じバスを使う複数の BusManager (別々のプロセスに相当します) の間で、
+// ターンを持つのが常にひとりであることを確かめます。
+func TestBusManagerMutualExclusion(t *testing.T) {
+	b := bus.NewMemoryBus()
+	defer b.Close()
+	managers := []Manager{NewBusManager(b), NewBusManager(b)}
+
+	var holders, maxHolders, turns int32
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		m := managers[i%len(managers)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if err := m.Acquire(context.Background()); err != nil {
+					t.Errorf("acquire: %v", err)
+					return
+				}
+				n := atomic.AddInt32(&holders, 1)
+				for {
+					max := atomic.LoadInt32(&maxHolders)
+					if n <= max || atomic.CompareAndSwapInt32(&maxHolders, max, n) {
+						break
+					}
+				}
+				time.Sleep(100 * time.Microsecond)
+				atomic.AddInt32(&holders, -1)
+				atomic.AddInt32(&turns, 1)
+				m.Release()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxHolders != 1 {
+		t.Errorf("got %d holders at once, want 1", maxHolders)
+	}
+	if turns != 120 {
+		t.Errorf("got %d turns, want 120", turns)
+	}
+}
+
+// TestBusManagerCancelledRequest は、待っている間に取り消された要求が、後の要求を妨げないことを確かめます。
+func TestBusManagerCancelledRequest(t *testing.T) {
+	b := bus.NewMemoryBus()
+	defer b.Close()
+	holder, other := NewBusManager(b), NewBusManager(b)
+
+	if err := holder.Acquire(context.Background()); err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := other.Acquire(ctx); err == nil {
+		t.Fatal("acquire succeeded while another manager held the turn")
+	}
+
+	holder.Release()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := other.Acquire(ctx); err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+	other.Release()
+}